@@ -1,21 +1,190 @@
 package s3fs
 
 import (
+	"cmp"
 	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
 	"io"
 	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-var _ NamespacedFS = (*azBlobFs)(nil)
+var (
+	_ NamespacedFS     = (*azBlobFs)(nil)
+	_ ContextualStatFS = (*azBlobFs)(nil)
+	_ ContextualGlobFS = (*azBlobFs)(nil)
+	_ ListFS           = (*azBlobFs)(nil)
+	_ ListAfterFS      = (*azBlobFs)(nil)
+	_ ListDirFS        = (*azBlobFs)(nil)
+	_ RangeReadFS      = (*azBlobFs)(nil)
+	_ MetadataFS       = (*azBlobFs)(nil)
+	_ ResumableFS      = (*azBlobFs)(nil)
+	_ StatsFS          = (*azBlobFs)(nil)
+)
 
 type azBlobFs struct {
 	container string
 	client    *azblob.Client
 
-	bufLen int64 // optional
+	objectConfig // optional
+	uploadConfig
+}
+
+// newAzBlobFs creates the azure blob backend.
+func newAzBlobFs(fs *awsS3) (NamespacedFS, error) {
+	if fs.azConnStr != "" {
+		if err := fs.applyConnectionString(fs.azConnStr); err != nil {
+			return nil, err
+		}
+	}
+	cli, err := fs.azClient()
+	if err != nil {
+		return nil, err
+	}
+	return &azBlobFs{
+		client:       cli,
+		container:    *fs.ns,
+		objectConfig: fs.objectConfig,
+		uploadConfig: fs.uploadConfig,
+	}, nil
+}
+
+// azClient creates the client by the first credential available:
+// token credential set by options, shared key, SAS token in the endpoint, then DefaultAzureCredential.
+func (a *awsS3) azClient() (*azblob.Client, error) {
+	if a.azCredential != nil {
+		cred, err := a.azCredential()
+		if err != nil {
+			return nil, err
+		}
+		return azblob.NewClient(a.endpoint, cred, a.azClientOptions())
+	}
+	if a.sk != "" {
+		cred, err := azblob.NewSharedKeyCredential(a.ak, a.sk)
+		if err != nil {
+			return nil, err
+		}
+		return azblob.NewClientWithSharedKeyCredential(a.endpoint, cred, a.azClientOptions())
+	}
+	u, err := url.Parse(a.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Query().Get("sig") != "" {
+		// SAS token
+		return azblob.NewClientWithNoCredential(a.endpoint, a.azClientOptions())
+	}
+	// Microsoft Entra ID
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	return azblob.NewClient(a.endpoint, cred, a.azClientOptions())
+}
+
+// Azurite, the azure storage emulator, well-known account.
+const (
+	devStoreAccount  = "devstoreaccount1"
+	devStoreKey      = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	devStoreProxyURI = "http://127.0.0.1"
+)
+
+// applyConnectionString sets the endpoint and the credential from the azure storage connection string, e.g.,
+//   - DefaultEndpointsProtocol=https;AccountName=<account>;AccountKey=<key>;EndpointSuffix=core.windows.net
+//   - BlobEndpoint=https://<account>.blob.core.windows.net/;SharedAccessSignature=<sas-token>
+//   - UseDevelopmentStorage=true
+func (a *awsS3) applyConnectionString(connStr string) error {
+	kv := make(map[string]string)
+	for part := range strings.SplitSeq(strings.TrimRight(connStr, ";"), ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return errors.New("s3fs: malformed azure connection string")
+		}
+		kv[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	if strings.EqualFold(kv["UseDevelopmentStorage"], "true") {
+		proxy := kv["DevelopmentStorageProxyUri"]
+		if proxy == "" {
+			proxy = devStoreProxyURI
+		}
+		a.endpoint = fmt.Sprintf("%s:10000/%s", strings.TrimRight(proxy, "/"), devStoreAccount)
+		a.ak, a.sk = devStoreAccount, devStoreKey
+		return nil
+	}
+
+	account := kv["AccountName"]
+	endpoint := kv["BlobEndpoint"]
+	if endpoint == "" {
+		if account == "" {
+			return errors.New("s3fs: azure connection string needs either AccountName or BlobEndpoint")
+		}
+		protocol := cmp.Or(kv["DefaultEndpointsProtocol"], "https")
+		suffix := cmp.Or(kv["EndpointSuffix"], "core.windows.net")
+		endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, account, suffix)
+	}
+	switch {
+	case account != "" && kv["AccountKey"] != "":
+		a.ak, a.sk = account, kv["AccountKey"]
+	case kv["SharedAccessSignature"] != "":
+		endpoint += "?" + strings.TrimPrefix(kv["SharedAccessSignature"], "?")
+	}
+	a.endpoint = endpoint
+	return nil
+}
+
+// azClientOptions returns the azure blob client options derived from the fs options.
+func (a *awsS3) azClientOptions() *azblob.ClientOptions {
+	opts := &azblob.ClientOptions{}
+	if a.retry != nil {
+		opts.Retry = a.retry.azureRetryOptions()
+	}
+	if a.requests != nil {
+		opts.PerRetryPolicies = append(opts.PerRetryPolicies, a.requests)
+	}
+	if a.observer != nil {
+		opts.PerCallPolicies = append(opts.PerCallPolicies, azurePartObserver{})
+	}
+	opts.PerCallPolicies = append(opts.PerCallPolicies, identityEncoding{})
+	return opts
+}
+
+// identityEncoding asks for blobs as stored. Otherwise, the transport of go asks for gzip itself, then
+// decompresses the gzip encoded blobs, e.g., of Compressed, and drops their Content-Length.
+type identityEncoding struct{}
+
+// Do implements policy.Policy.
+func (identityEncoding) Do(req *policy.Request) (*http.Response, error) {
+	req.Raw().Header.Set("Accept-Encoding", "identity")
+	return req.Next()
+}
+
+// location identifies the container, i.e., <endpoint>/<container>.
+func (a *azBlobFs) location() string {
+	return newBlobClient(a.client, a.container, a.sse, a.checksum).location()
+}
+
+// objectClient returns the client of the blobs of the container.
+func (a *azBlobFs) objectClient() client {
+	return a.hedged(a.logged(a.observed(newBlobClient(a.client, a.container, a.sse, a.checksum))))
 }
 
 // Namespace implements NamespacedFS.
@@ -30,8 +199,12 @@ func (a *azBlobFs) Namespace(container string) FS {
 
 // Delete implements FS.
 func (a *azBlobFs) Delete(ctx context.Context, name string) error {
+	ctx, done := observe(ctx, a.observer, &Operation{Op: OpDelete, Namespace: a.container, Key: name})
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
 	_, err := a.client.DeleteBlob(ctx, a.container, name, nil)
-	return err
+	done(0, err)
+	return notFoundError("delete", name, err)
 }
 
 // Open implements FS.
@@ -41,31 +214,206 @@ func (a *azBlobFs) Open(name string) (fs.File, error) {
 
 // OpenWithContext implements FS.
 func (a *azBlobFs) OpenWithContext(ctx context.Context, name string) (fs.File, error) {
-	obj := &object{
-		ctx:    ctx,
-		client: newBlobClient(a.client, a.container),
-		bufLen: a.bufLen,
-		name:   name,
-	}
-	return obj, obj.fillChunk(false)
+	return a.openObject(ctx, a.objectClient(), name)
 }
 
 // PresignGet implements FS.
 func (a *azBlobFs) PresignGet(ctx context.Context, name string, optFns ...func(*s3.PresignOptions)) (string, error) {
-	panic("unimplemented")
+	return "", fmt.Errorf("s3fs: presign azure blob: %w", errors.ErrUnsupported)
 }
 
 // PresignPut implements FS.
 func (a *azBlobFs) PresignPut(ctx context.Context, name string, optFns ...func(*s3.PresignOptions)) (string, error) {
-	panic("unimplemented")
+	return "", fmt.Errorf("s3fs: presign azure blob: %w", errors.ErrUnsupported)
 }
 
 // Put implements FS.
 func (a *azBlobFs) Put(ctx context.Context, name string, reader io.Reader) error {
-	_, err := a.client.UploadStream(ctx, a.container, name, reader, nil)
+	return a.PutWithMetadata(ctx, name, reader, Metadata{})
+}
+
+// PutWithMetadata implements MetadataFS.
+func (a *azBlobFs) PutWithMetadata(ctx context.Context, name string, reader io.Reader, metadata Metadata) (err error) {
+	t := a.track(OpPut, name, readerSize(reader))
+	op := &Operation{Op: OpPut, Namespace: a.container, Key: name}
+	ctx, done := observe(ctx, a.observer, op)
+	defer func() { done(t.transferred(), err) }()
+	ctx = a.observeParts(ctx, op)
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
+	sse, err := sseFrom(ctx, a.sse)
+	if err != nil {
+		return err
+	}
+	opts := &azblob.UploadStreamOptions{
+		BlockSize:    a.partSize,
+		Concurrency:  a.concurrency,
+		CPKInfo:      sse.cpkInfo(),
+		CPKScopeInfo: sse.cpkScopeInfo(),
+	}
+	if metadata.ContentType != "" || metadata.ContentEncoding != "" || a.checksum != "" {
+		opts.HTTPHeaders = &blob.HTTPHeaders{}
+		if metadata.ContentType != "" {
+			opts.HTTPHeaders.BlobContentType = &metadata.ContentType
+		}
+		if metadata.ContentEncoding != "" {
+			opts.HTTPHeaders.BlobContentEncoding = &metadata.ContentEncoding
+		}
+	}
+	body := a.bandwidth.reader(ctx, t.reader(reader))
+	if a.checksum != "" {
+		opts.TransactionalValidation = blob.TransferValidationTypeComputeCRC64()
+		body = &md5Reader{r: body, hash: md5.New(), headers: opts.HTTPHeaders}
+	}
+	for k, v := range metadata.User {
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]*string, len(metadata.User))
+		}
+		opts.Metadata[k] = &v
+	}
+	_, err = a.client.UploadStream(ctx, a.container, name, body, opts)
 	return err
 }
 
+// md5Reader hashes the content read, whose Content-MD5 is set to the headers at EOF,
+// i.e., before UploadStream commits the blob with them.
+type md5Reader struct {
+	r       io.Reader
+	hash    hash.Hash
+	headers *blob.HTTPHeaders
+}
+
+// Read implements io.Reader.
+func (r *md5Reader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.hash.Write(b[:n])
+	if err == io.EOF {
+		r.headers.BlobContentMD5 = r.hash.Sum(nil)
+	}
+	return n, err
+}
+
+// Stat implements ContextualStatFS.
+func (a *azBlobFs) Stat(name string) (fs.FileInfo, error) {
+	return a.StatWithContext(context.Background(), name)
+}
+
+// StatWithContext implements ContextualStatFS.
+func (a *azBlobFs) StatWithContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.objectClient().headObject(ctx, name, "")
+}
+
+// statIfNoneMatch implements conditionalStatFS.
+func (a *azBlobFs) statIfNoneMatch(ctx context.Context, name, etag string) (fs.FileInfo, error) {
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
+	info, err := a.objectClient().headObject(ctx, name, etag)
+	if err != nil {
+		return nil, err // not a typed nil
+	}
+	return info, nil
+}
+
+// ReadRange implements RangeReadFS.
+func (a *azBlobFs) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	return a.readRange(ctx, a.objectClient(), name, offset, length)
+}
+
+// List implements ListFS.
+func (a *azBlobFs) List(ctx context.Context, prefix string, fn func(fs.FileInfo) error) (err error) {
+	ctx, done := observe(ctx, a.observer, &Operation{Op: OpList, Namespace: a.container, Key: prefix})
+	defer func() { done(0, err) }()
+	p := a.client.NewListBlobsFlatPager(a.container, &azblob.ListBlobsFlatOptions{
+		Prefix:  &prefix,
+		Include: azblob.ListBlobsInclude{Metadata: true},
+	})
+	for p.More() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, blob := range page.Segment.BlobItems {
+			if err := fn(blobInfo(blob)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// blobInfo returns the info of the listed blob, with the user metadata if listed.
+func blobInfo(blob *container.BlobItem) *objectInfo {
+	info := &objectInfo{name: *blob.Name}
+	for k, v := range blob.Metadata {
+		if info.metadata.User == nil {
+			info.metadata.User = make(map[string]string, len(blob.Metadata))
+		}
+		if v != nil {
+			info.metadata.User[strings.ToLower(k)] = *v
+		}
+	}
+	if props := blob.Properties; props != nil {
+		if props.ContentLength != nil {
+			info.size = *props.ContentLength
+		}
+		if props.LastModified != nil {
+			info.modTime = *props.LastModified
+		}
+		if props.ETag != nil {
+			info.etag = string(*props.ETag)
+		}
+	}
+	return info
+}
+
+// ListAfter implements ListAfterFS. Blobs are listed in lexical order, but not from a name, so the ones before
+// it are listed and skipped.
+func (a *azBlobFs) ListAfter(ctx context.Context, prefix, after string, fn func(fs.FileInfo) error) error {
+	return a.List(ctx, prefix, func(info fs.FileInfo) error {
+		if info.Name() <= after {
+			return nil
+		}
+		return fn(info)
+	})
+}
+
+// ListDir implements ListDirFS.
+func (a *azBlobFs) ListDir(ctx context.Context, prefix string, fn func(fs.FileInfo) error) (err error) {
+	ctx, done := observe(ctx, a.observer, &Operation{Op: OpList, Namespace: a.container, Key: prefix})
+	defer func() { done(0, err) }()
+	p := a.client.ServiceClient().NewContainerClient(a.container).NewListBlobsHierarchyPager("/",
+		&container.ListBlobsHierarchyOptions{Prefix: &prefix})
+	for p.More() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, blob := range page.Segment.BlobItems {
+			if err := fn(blobInfo(blob)); err != nil {
+				return err
+			}
+		}
+		for _, dir := range page.Segment.BlobPrefixes {
+			if err := fn(&dirInfo{strings.TrimSuffix(*dir.Name, "/")}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Glob implements ContextualGlobFS.
+func (a *azBlobFs) Glob(pattern string) ([]string, error) {
+	return a.GlobWithContext(context.Background(), pattern)
+}
+
+// GlobWithContext implements ContextualGlobFS.
+func (a *azBlobFs) GlobWithContext(ctx context.Context, pattern string) ([]string, error) {
+	return glob(ctx, a, pattern)
+}
+
 // ReadFile implements FS.
 func (a *azBlobFs) ReadFile(name string) ([]byte, error) {
 	return a.ReadFileWithContext(context.Background(), name)
@@ -73,14 +421,82 @@ func (a *azBlobFs) ReadFile(name string) ([]byte, error) {
 
 // ReadFileWithContext implements FS.
 func (a *azBlobFs) ReadFileWithContext(ctx context.Context, name string) ([]byte, error) {
-	obj := &object{
-		ctx:    ctx,
-		client: newBlobClient(a.client, a.container),
-		bufLen: a.bufLen,
-		name:   name,
-	}
+	obj := a.newObject(ctx, a.objectClient(), name)
+	defer obj.cancel()
 	if err := obj.dl(); err != nil {
 		return nil, err
 	}
 	return obj.buf.Bytes(), nil
 }
+
+// PutResumable implements ResumableFS, blocks are staged then committed, where uncommitted ones are kept by the
+// service for a week.
+func (a *azBlobFs) PutResumable(ctx context.Context, name string, r io.ReaderAt, size int64, checkpoint string) (err error) {
+	t := a.track(OpPut, name, size)
+	op := &Operation{Op: OpPut, Namespace: a.container, Key: name}
+	ctx, done := observe(ctx, a.observer, op)
+	defer func() { done(t.transferred(), err) }()
+	ctx = a.observeParts(ctx, op)
+	sse, err := sseFrom(ctx, a.sse)
+	if err != nil {
+		return err
+	}
+	partSize := a.partSizeFor(size, 4<<20, blockblob.MaxBlocks)
+	cp, err := loadCheckpoint(checkpoint, a.location(), name, size, partSize)
+	if err != nil {
+		return err
+	}
+	up := &blobUpload{
+		client: a.client.ServiceClient().NewContainerClient(a.container).NewBlockBlobClient(name),
+		sse:    sse,
+	}
+	if a.checksum != "" {
+		up.validation = blob.TransferValidationTypeComputeCRC64()
+	}
+	return putResumable(ctx, up, cp, checkpoint, r, cmp.Or(a.concurrency, 1), t, a.bandwidth)
+}
+
+// blobUpload stages the blocks of a block blob.
+type blobUpload struct {
+	client     *blockblob.Client
+	sse        *SSE
+	validation blob.TransferValidationType
+}
+
+// create returns a random id prefixing the block ids, so that blocks left by other uploads are never committed.
+func (u *blobUpload) create(ctx context.Context) (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// blockID returns the block id of the part, which has the same length for all the blocks of the blob.
+func blockID(uploadID string, number int32) string {
+	return base64.StdEncoding.EncodeToString(fmt.Appendf(nil, "%s-%05d", uploadID, number))
+}
+
+func (u *blobUpload) uploadPart(ctx context.Context, uploadID string, number int32, body io.ReadSeeker) (checkpointPart, error) {
+	_, err := u.client.StageBlock(ctx, blockID(uploadID, number), streaming.NopCloser(body), &blockblob.StageBlockOptions{
+		CPKInfo:                 u.sse.cpkInfo(),
+		CPKScopeInfo:            u.sse.cpkScopeInfo(),
+		TransactionalValidation: u.validation,
+	})
+	return checkpointPart{Number: number}, err
+}
+
+func (u *blobUpload) complete(ctx context.Context, uploadID string, parts []checkpointPart) error {
+	ids := make([]string, len(parts))
+	for i, p := range parts {
+		ids[i] = blockID(uploadID, p.Number)
+	}
+	_, err := u.client.CommitBlockList(ctx, ids, &blockblob.CommitBlockListOptions{
+		CPKInfo:      u.sse.cpkInfo(),
+		CPKScopeInfo: u.sse.cpkScopeInfo(),
+	})
+	if bloberror.HasCode(err, bloberror.InvalidBlockList) { // the blocks staged expired
+		return fmt.Errorf("%w: %w", errUploadGone, err)
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package s3fs_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestAzureConnectionString(t *testing.T) {
+	var method, path, auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	const key = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	fs, err := s3fs.New(
+		s3fs.WithAzureConnectionString("DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey="+key+";BlobEndpoint="+ts.URL+"/devstoreaccount1;"),
+		s3fs.WithNamespace("container"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Delete(context.TODO(), "path/to/blob"); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodDelete || path != "/devstoreaccount1/container/path/to/blob" {
+		t.Fatalf("got %s %s, want DELETE /devstoreaccount1/container/path/to/blob", method, path)
+	}
+	if !strings.HasPrefix(auth, "SharedKey devstoreaccount1:") {
+		t.Fatalf("got Authorization %q, want shared key of devstoreaccount1", auth)
+	}
+}
+
+func TestAzureCredentialError(t *testing.T) {
+	_, err := s3fs.New(
+		s3fs.WithEndpoint("https://account.blob.core.windows.net"),
+		s3fs.WithNamespace("container"),
+		s3fs.WithAzureClientSecret("invalid tenant", "client", "secret"),
+	)
+	if err == nil {
+		t.Fatal("New with invalid tenant should fail")
+	}
+	_, err = s3fs.New(
+		s3fs.WithAzureConnectionString("AccountKey=key"),
+		s3fs.WithNamespace("container"),
+	)
+	if err == nil {
+		t.Fatal("New with neither AccountName nor BlobEndpoint should fail")
+	}
+}
@@ -0,0 +1,78 @@
+package s3fs
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Names of the built-in backends.
+const (
+	BackendS3     = "s3"
+	BackendAzBlob = "azblob"
+)
+
+// Config is the snapshot of the options passed to New, for custom backends.
+type Config struct {
+	Endpoint  string
+	Region    string
+	Namespace string
+	AccessKey string
+	SecretKey string
+	// SessionToken is set by WithSessionToken.
+	SessionToken string
+	BufferSize   int64
+}
+
+// BackendFactory creates a fs from the config.
+type BackendFactory func(cfg Config) (NamespacedFS, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]func(*awsS3) (NamespacedFS, error){
+		BackendS3:     newAwsS3,
+		BackendAzBlob: newAzBlobFs,
+	}
+)
+
+// RegisterBackend registers the factory of the backend name, which can be selected by WithBackend.
+// It replaces the existing one if any, including the built-in ones.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = func(fs *awsS3) (NamespacedFS, error) {
+		return factory(fs.config())
+	}
+}
+
+// config returns the exported snapshot of the options.
+func (a *awsS3) config() Config {
+	return Config{
+		Endpoint:     a.endpoint,
+		Region:       a.region,
+		Namespace:    aws.ToString(a.ns),
+		AccessKey:    a.ak,
+		SecretKey:    a.sk,
+		SessionToken: a.token,
+		BufferSize:   a.bufLen,
+	}
+}
+
+// detectBackend guesses the backend from the endpoint, for backward compatibility.
+func detectBackend(endpoint string) string {
+	if strings.Contains(endpoint, "blob.core") {
+		return BackendAzBlob
+	}
+	return BackendS3
+}
+
+// WithBackend selects the backend by name explicitly, e.g., BackendAzBlob for Azurite, Azure Stack,
+// private endpoints or custom domains, or the ones registered by RegisterBackend.
+//
+// If not set, the backend is guessed from the endpoint: *.blob.core.* is azure blob, otherwise s3.
+func WithBackend(name string) Option {
+	return func(fs *awsS3) {
+		fs.backend = name
+	}
+}
@@ -0,0 +1,39 @@
+package s3fs_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestRegisterBackend(t *testing.T) {
+	if _, err := s3fs.New(s3fs.WithBackend("dir"), s3fs.WithNamespace("ns")); err == nil {
+		t.Fatal("New with unknown backend should fail")
+	}
+
+	root := t.TempDir()
+	s3fs.RegisterBackend("dir", func(cfg s3fs.Config) (s3fs.NamespacedFS, error) {
+		return s3fs.DirFS(filepath.Join(root, cfg.Endpoint, cfg.Namespace)).(s3fs.NamespacedFS), nil
+	})
+	fs, err := s3fs.New(
+		s3fs.WithBackend("dir"),
+		s3fs.WithEndpoint("blob.core.example.com"), // explicit backend wins over detection
+		s3fs.WithNamespace("ns"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Put(context.TODO(), "key", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := s3fs.DirFS(filepath.Join(root, "blob.core.example.com", "ns")).ReadFile("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("read %q, want %q", b, "hello")
+	}
+}
@@ -0,0 +1,397 @@
+package s3fs
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ ContextualStatFS = (*cacheFs)(nil)
+
+// CacheOption configures the fs returned by Cached.
+type CacheOption func(c *cacheFs)
+
+// WithCacheMaxSize sets the max bytes of the cache dir, the least recently used files are evicted beyond it.
+// Defaults to zero, i.e., unlimited.
+func WithCacheMaxSize(maxSize int64) CacheOption {
+	return func(c *cacheFs) {
+		c.maxSize = maxSize
+	}
+}
+
+// WithCacheLocation sets the location identifying the fs in the cache dir, it defaults to the
+// endpoint and namespace of the built-in backends. It must be set for the others which share a cache dir.
+func WithCacheLocation(location string) CacheOption {
+	return func(c *cacheFs) {
+		c.location = location
+	}
+}
+
+// Cached wraps the fs with a read-through cache on the local disk dir.
+//
+// Files are cached by the location of the fs, their names and ETags. Each open revalidates the cached
+// file with a HEAD request, conditional on its ETag for the built-in backends, and downloads it again
+// only if its ETag changed.
+// The dir can be shared by multiple processes, files are written to a temp file and renamed into place.
+// The cache dir is scanned for eviction once started, and whenever it gets beyond the max size.
+func Cached(fsys FS, dir string, options ...CacheOption) FS {
+	c := &cacheFs{
+		fsys:    fsys,
+		dir:     dir,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	if l, ok := fsys.(interface{ location() string }); ok {
+		c.location = l.location()
+	}
+	for _, op := range options {
+		op(c)
+	}
+	return c
+}
+
+type cacheFs struct {
+	fsys     FS
+	dir      string
+	location string
+	maxSize  int64
+
+	mu       sync.Mutex
+	scanned  bool
+	scanning bool
+	size     int64
+	lru      *list.List               // of *cacheEntry, the front is the most recently used.
+	entries  map[string]*list.Element // by keyPath
+}
+
+// cacheEntry is a file in the cache dir, whose info is known if opened by this process.
+type cacheEntry struct {
+	key  string
+	path string
+	size int64
+	info fs.FileInfo
+}
+
+// conditionalStatFS stats files only if changed, which is implemented by the built-in backends.
+type conditionalStatFS interface {
+	// statIfNoneMatch is like StatWithContext, but returns errNotModified if the file has the ETag.
+	statIfNoneMatch(ctx context.Context, name, etag string) (fs.FileInfo, error)
+}
+
+// cachedFile is a file in the cache dir, but stats as the original one.
+type cachedFile struct {
+	*os.File
+	info fs.FileInfo
+}
+
+// Stat implements fs.File.
+func (f *cachedFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Open implements FS.
+func (c *cacheFs) Open(name string) (fs.File, error) {
+	return c.OpenWithContext(context.Background(), name)
+}
+
+// OpenWithContext implements FS.
+func (c *cacheFs) OpenWithContext(ctx context.Context, name string) (fs.File, error) {
+	info, src, err := c.revalidate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if src != nil {
+		defer src.Close()
+	}
+
+	fname := c.path(name, etag(info))
+	if f, err := os.Open(fname); err == nil {
+		now := time.Now()
+		_ = os.Chtimes(fname, now, now) // mark as recently used for other processes
+		if fi, err := f.Stat(); err == nil {
+			c.index(name, fname, fi.Size(), info)
+		}
+		return &cachedFile{File: f, info: info}, nil
+	}
+
+	if src == nil {
+		if src, err = c.fsys.OpenWithContext(ctx, name); err != nil {
+			return nil, err
+		}
+		defer src.Close()
+		// the file may have changed since the stat, so it's cached as the version actually read
+		if fi, err := src.Stat(); err == nil && etag(fi) != etag(info) {
+			info = &objectInfo{name: info.Name(), size: fi.Size(), modTime: fi.ModTime(), etag: etag(fi)}
+			fname = c.path(name, etag(info))
+		}
+	}
+	f, err := c.fill(name, fname, info, src)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedFile{File: f, info: info}, nil
+}
+
+// revalidate stats the file, conditional on the ETag of its cached version if the fs supports it.
+func (c *cacheFs) revalidate(ctx context.Context, name string) (fs.FileInfo, fs.File, error) {
+	if s, ok := c.fsys.(conditionalStatFS); ok {
+		c.mu.Lock()
+		var cached fs.FileInfo
+		if e, ok := c.entries[c.keyPath(name)]; ok {
+			cached = e.Value.(*cacheEntry).info
+		}
+		c.mu.Unlock()
+		if cached != nil {
+			info, err := s.statIfNoneMatch(ctx, name, etag(cached))
+			if errors.Is(err, errNotModified) {
+				return cached, nil, nil
+			}
+			return info, nil, err
+		}
+	}
+	return c.stat(ctx, name)
+}
+
+// stat gets the file info, by opening the file if the fs can't stat, in which case the opened file is returned.
+func (c *cacheFs) stat(ctx context.Context, name string) (fs.FileInfo, fs.File, error) {
+	if s, ok := c.fsys.(ContextualStatFS); ok {
+		info, err := s.StatWithContext(ctx, name)
+		return info, nil, err
+	}
+	f, err := c.fsys.OpenWithContext(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return info, f, nil
+}
+
+// fill writes src to the cache file fname of the file name and info, replacing its stale versions, then evicts if it's full.
+// The returned file is opened before being renamed into place, so it survives eviction by other processes.
+func (c *cacheFs) fill(name, fname string, info fs.FileInfo, src io.Reader) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fname), ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	c.invalidate(name)
+	if err := os.Rename(tmp.Name(), fname); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if fi, err := tmp.Stat(); err == nil {
+		c.index(name, fname, fi.Size(), info)
+	}
+	return tmp, nil
+}
+
+// keyPath returns the path prefix of all cached versions of the file, i.e., <dir>/<xx>/<hash(location, name)>.
+func (c *cacheFs) keyPath(name string) string {
+	sum := sha256.Sum256([]byte(c.location + "\x00" + name))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// path returns the cache file of the given version of the file, i.e., <keyPath>.<hash(etag)>.
+func (c *cacheFs) path(name, etag string) string {
+	sum := sha256.Sum256([]byte(etag))
+	return c.keyPath(name) + "." + hex.EncodeToString(sum[:8])
+}
+
+// invalidate removes all cached versions of the file.
+func (c *cacheFs) invalidate(name string) {
+	key := c.keyPath(name)
+	matches, _ := filepath.Glob(key + ".*")
+	for _, m := range matches {
+		_ = os.Remove(m)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+}
+
+// index marks the cache file of the file as the most recently used, with its info if known.
+// The cache dir is scanned and evicted on the first call, and whenever the size gets beyond the max.
+func (c *cacheFs) index(name, fname string, size int64, info fs.FileInfo) {
+	key := c.keyPath(name)
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, path: fname, size: size, info: info})
+	c.size += size
+	full := c.maxSize > 0 && (!c.scanned || c.size > c.maxSize)
+	c.mu.Unlock()
+	if full {
+		c.rescan()
+	}
+}
+
+// remove drops the entry from the index, but not the file.
+func (c *cacheFs) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	if c.entries[entry.key] == e {
+		delete(c.entries, entry.key)
+	}
+	c.size -= entry.size
+}
+
+// rescan rebuilds the index from the cache dir and evicts, the dir is walked without holding the lock
+// and by one caller at a time.
+func (c *cacheFs) rescan() {
+	c.mu.Lock()
+	if c.scanning {
+		c.mu.Unlock()
+		return
+	}
+	c.scanning = true
+	c.mu.Unlock()
+
+	files := c.scan()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scanning = false
+	c.swap(files)
+	c.evict()
+}
+
+// scan lists the files of the cache dir from the least recently modified, which covers the files of other
+// processes sharing the dir.
+func (c *cacheFs) scan() []*cacheEntry {
+	type file struct {
+		entry   *cacheEntry
+		modTime time.Time
+	}
+	var files []file
+	_ = filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		key := strings.TrimSuffix(path, filepath.Ext(path))
+		files = append(files, file{&cacheEntry{key: key, path: path, size: info.Size()}, info.ModTime()})
+		return nil
+	})
+	slices.SortFunc(files, func(a, b file) int { return a.modTime.Compare(b.modTime) })
+	entries := make([]*cacheEntry, len(files))
+	for i, f := range files {
+		entries[i] = f.entry
+	}
+	return entries
+}
+
+// swap replaces the index with the scanned files, the infos known are kept. The files indexed since the scan
+// started are kept as the most recently used.
+func (c *cacheFs) swap(files []*cacheEntry) {
+	known, lru := c.entries, c.lru
+	c.lru = list.New()
+	c.entries = make(map[string]*list.Element, len(files))
+	c.size = 0
+	scanned := make(map[string]bool, len(files))
+	for _, f := range files {
+		scanned[f.path] = true
+		if e, ok := known[f.key]; ok && e.Value.(*cacheEntry).path == f.path {
+			f.info = e.Value.(*cacheEntry).info
+		}
+		// a stale version of other processes, if any, stays in the lru until evicted
+		c.entries[f.key] = c.lru.PushFront(f)
+		c.size += f.size
+	}
+	for e := lru.Back(); e != nil; e = e.Prev() {
+		if entry := e.Value.(*cacheEntry); !scanned[entry.path] {
+			c.entries[entry.key] = c.lru.PushFront(entry)
+			c.size += entry.size
+		}
+	}
+	c.scanned = true
+}
+
+// evict removes the least recently used files until the cache fits in the max size.
+// Other processes may remove the same files at the same time, so errors are ignored.
+func (c *cacheFs) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		e := c.lru.Back()
+		path := e.Value.(*cacheEntry).path
+		c.remove(e)
+		_ = os.Remove(path)
+	}
+}
+
+// etag returns the ETag of the file, or a weak one made of its size and modification time.
+func etag(info fs.FileInfo) string {
+	if e, ok := info.(ETagger); ok && e.ETag() != "" {
+		return e.ETag()
+	}
+	return fmt.Sprintf("W/%x-%x", info.Size(), info.ModTime().UnixNano())
+}
+
+// ReadFile implements FS.
+func (c *cacheFs) ReadFile(name string) ([]byte, error) {
+	return c.ReadFileWithContext(context.Background(), name)
+}
+
+// ReadFileWithContext implements FS.
+func (c *cacheFs) ReadFileWithContext(ctx context.Context, name string) ([]byte, error) {
+	f, err := c.OpenWithContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Stat implements ContextualStatFS.
+func (c *cacheFs) Stat(name string) (fs.FileInfo, error) {
+	return c.StatWithContext(context.Background(), name)
+}
+
+// StatWithContext implements ContextualStatFS.
+func (c *cacheFs) StatWithContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	info, f, err := c.stat(ctx, name)
+	if f != nil {
+		f.Close()
+	}
+	return info, err
+}
+
+// Put implements FS.
+func (c *cacheFs) Put(ctx context.Context, name string, reader io.Reader) error {
+	c.invalidate(name)
+	return c.fsys.Put(ctx, name, reader)
+}
+
+// Delete implements FS.
+func (c *cacheFs) Delete(ctx context.Context, name string) error {
+	c.invalidate(name)
+	return c.fsys.Delete(ctx, name)
+}
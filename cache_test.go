@@ -0,0 +1,211 @@
+package s3fs_test
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func cacheFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCached(t *testing.T) {
+	remote, fn := newTestFs()
+	defer fn()
+	dir := t.TempDir()
+	cached := s3fs.Cached(remote, dir, s3fs.WithCacheMaxSize(250))
+
+	put := func(name, content string) {
+		t.Helper()
+		if err := remote.Put(context.TODO(), name, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name, want string) {
+		t.Helper()
+		b, err := cached.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Fatalf("ReadFile(%q) = %q, want %q", name, b, want)
+		}
+	}
+
+	put("a", "hello")
+	read("a", "hello")
+	read("a", "hello")
+	if files := cacheFiles(t, dir); len(files) != 1 {
+		t.Fatalf("got cache files %v, want 1", files)
+	}
+
+	// revalidated by ETag
+	put("a", "world")
+	read("a", "world")
+	if files := cacheFiles(t, dir); len(files) != 1 {
+		t.Fatalf("got cache files %v after change, want 1", files)
+	}
+
+	// least recently used evicted
+	put("b", strings.Repeat("b", 100))
+	put("c", strings.Repeat("c", 100))
+	put("d", strings.Repeat("d", 100))
+	read("b", strings.Repeat("b", 100))
+	read("c", strings.Repeat("c", 100))
+	read("d", strings.Repeat("d", 100))
+	if files := cacheFiles(t, dir); len(files) != 2 {
+		t.Fatalf("got cache files %v beyond max size, want 2", files)
+	}
+
+	f, err := cached.Open("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "d" || info.Size() != 100 {
+		t.Fatalf("Stat = %q %d, want the remote file d of 100 bytes", info.Name(), info.Size())
+	}
+
+	if err := cached.Delete(context.TODO(), "d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.ReadFile("d"); err == nil {
+		t.Fatal("ReadFile after Delete should fail")
+	}
+}
+
+func TestCachedRevalidate(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		heads []string // the If-None-Match and status of HEADs
+	)
+	remote, fn := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, r)
+		mu.Lock()
+		heads = append(heads, fmt.Sprintf("%s %d", r.Header.Get("If-None-Match"), rec.Code))
+		mu.Unlock()
+		maps.Copy(w.Header(), rec.Header())
+		w.WriteHeader(rec.Code)
+	}))
+	defer fn()
+	dir := t.TempDir()
+	cached := s3fs.Cached(remote, dir)
+	if err := remote.Put(context.TODO(), "a", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := remote.(s3fs.ContextualStatFS).Stat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := info.(s3fs.ETagger).ETag()
+	heads = nil
+
+	for range 2 {
+		b, err := cached.ReadFile("a")
+		if err != nil || string(b) != "hello" {
+			t.Fatalf("ReadFile = %q, %v", b, err)
+		}
+	}
+	f, err := cached.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.Size() != 5 || info.Name() != "a" {
+		t.Fatalf("Stat of the not modified file = %v, %v", info, err)
+	}
+	want := []string{" 200", etag + " 304", etag + " 304"}
+	if !slices.Equal(heads, want) {
+		t.Fatalf("HEADs %q, want %q", heads, want)
+	}
+
+	// a new cache of the dir starts from the files cached
+	put := func(name string) {
+		t.Helper()
+		if err := remote.Put(context.TODO(), name, strings.NewReader(strings.Repeat(name, 100))); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s3fs.Cached(remote, dir, s3fs.WithCacheMaxSize(150)).ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("b")
+	put("c")
+	if files := cacheFiles(t, dir); len(files) != 1 {
+		t.Fatalf("got cache files %v beyond max size, want 1", files)
+	}
+}
+
+func TestCachedChangedSinceStat(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		heads  []int // the status of HEADs
+		remote s3fs.NamespacedFS
+	)
+	remote, fn := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, r)
+		mu.Lock()
+		heads = append(heads, rec.Code)
+		first := len(heads) == 1
+		mu.Unlock()
+		// the file changes between the stat and the download of the first open
+		if first {
+			if err := remote.Put(context.TODO(), "a", strings.NewReader("world")); err != nil {
+				t.Error(err)
+			}
+		}
+		maps.Copy(w.Header(), rec.Header())
+		w.WriteHeader(rec.Code)
+	}))
+	defer fn()
+	if err := remote.Put(context.TODO(), "a", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	cached := s3fs.Cached(remote, t.TempDir())
+	for range 2 {
+		b, err := cached.ReadFile("a")
+		if err != nil || string(b) != "world" {
+			t.Fatalf("ReadFile = %q, %v, want the version read", b, err)
+		}
+	}
+	// cached by the ETag of the version read, so it's not modified since
+	if want := []int{200, 304}; !slices.Equal(heads, want) {
+		t.Fatalf("HEADs %v, want %v", heads, want)
+	}
+}
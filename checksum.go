@@ -0,0 +1,113 @@
+package s3fs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io/fs"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ChecksumAlgorithm is the algorithm of the checksums of objects.
+type ChecksumAlgorithm string
+
+// The checksum algorithms, see WithChecksum.
+const (
+	ChecksumCRC32     ChecksumAlgorithm = "CRC32"
+	ChecksumCRC32C    ChecksumAlgorithm = "CRC32C"
+	ChecksumCRC64NVME ChecksumAlgorithm = "CRC64NVME"
+	ChecksumSHA1      ChecksumAlgorithm = "SHA1"
+	ChecksumSHA256    ChecksumAlgorithm = "SHA256"
+	// ChecksumMD5 is the Content-MD5 of azure blob, which is not a flexible checksum of aws s3.
+	ChecksumMD5 ChecksumAlgorithm = "MD5"
+)
+
+// ErrChecksumMismatch is returned reading an object whose content doesn't match its stored checksum.
+var ErrChecksumMismatch = errors.New("s3fs: checksum mismatch")
+
+// WithChecksum enables the integrity checks of objects, which are off by default:
+//   - aws s3 uploads send the checksums of the algorithm with each request or part, validated by the service.
+//     Whole downloads are verified by the full object checksum if stored, and Stat reports it.
+//   - azure blob uploads send the transactional CRC64 of each block whatever the algorithm is, but streams smaller
+//     than a block, i.e., 1MiB, which are put at once without it by the sdk. Put stores the Content-MD5 of the blob
+//     computed while uploading, but PutResumable doesn't.
+//     Whole downloads are verified by the Content-MD5 of the blob if stored, and Stat reports it.
+//
+// Checksums of multipart objects of aws s3 are composite, i.e., checksums of the checksums of parts, except CRC64NVME,
+// thus they can't be verified after downloading.
+func WithChecksum(algorithm ChecksumAlgorithm) Option {
+	return func(fs *awsS3) {
+		fs.checksum = algorithm
+	}
+}
+
+// newChecksum returns the hash of the algorithm, or nil if unknown.
+func newChecksum(algorithm ChecksumAlgorithm) hash.Hash {
+	switch algorithm {
+	case ChecksumCRC32:
+		return crc32.NewIEEE()
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case ChecksumCRC64NVME:
+		return crc64.New(crc64.MakeTable(0x9a6c9329ac4bc9b5)) // the reversed NVME polynomial
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	case ChecksumMD5:
+		return md5.New()
+	}
+	return nil
+}
+
+// verifyChecksum verifies the content by the base64 checksum of the algorithm, unknown algorithms are skipped.
+func verifyChecksum(name string, b []byte, algorithm ChecksumAlgorithm, checksum string) error {
+	h := newChecksum(algorithm)
+	if h == nil || checksum == "" {
+		return nil
+	}
+	h.Write(b)
+	if want, err := base64.StdEncoding.DecodeString(checksum); err != nil || !bytes.Equal(h.Sum(nil), want) {
+		return &fs.PathError{Op: "read", Path: name, Err: ErrChecksumMismatch}
+	}
+	return nil
+}
+
+// s3Checksum returns the full object checksum of the response, composite ones are skipped.
+func s3Checksum(typ types.ChecksumType, crc32, crc32c, crc64nvme, sha1, sha256 *string) (ChecksumAlgorithm, string) {
+	if typ == types.ChecksumTypeComposite {
+		return "", ""
+	}
+	for _, c := range []struct {
+		algorithm ChecksumAlgorithm
+		value     *string
+	}{
+		{ChecksumCRC64NVME, crc64nvme},
+		{ChecksumCRC32C, crc32c},
+		{ChecksumCRC32, crc32},
+		{ChecksumSHA256, sha256},
+		{ChecksumSHA1, sha1},
+	} {
+		// composite checksums are suffixed by the number of parts, e.g., "<base64>-3".
+		if c.value != nil && !strings.Contains(*c.value, "-") {
+			return c.algorithm, *c.value
+		}
+	}
+	return "", ""
+}
+
+// azureChecksum returns the Content-MD5 of the blob if any.
+func azureChecksum(md5 []byte) (ChecksumAlgorithm, string) {
+	if len(md5) == 0 {
+		return "", ""
+	}
+	return ChecksumMD5, base64.StdEncoding.EncodeToString(md5)
+}
@@ -0,0 +1,176 @@
+package s3fs_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestChecksum(t *testing.T) {
+	const content = "hello, checksum"
+	crc := crc32.Checksum([]byte(content), crc32.MakeTable(crc32.Castagnoli))
+	sum := base64.StdEncoding.EncodeToString([]byte{byte(crc >> 24), byte(crc >> 16), byte(crc >> 8), byte(crc)})
+
+	// gofakes3 replays the checksum headers put, which is overridden by the stored one for whole GETs and HEADs.
+	var putChecksum, stored string
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		switch {
+		case r.Method == http.MethodPut:
+			putChecksum = r.Header.Get("X-Amz-Checksum-Crc32c")
+		case r.Header.Get("Range") == "" && r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED":
+			w = &headerOverrider{ResponseWriter: w, key: "X-Amz-Checksum-Crc32c", value: stored}
+		}
+		next.ServeHTTP(w, r)
+	}), withOptions(s3fs.WithBufferSize(0), s3fs.WithChecksum(s3fs.ChecksumCRC32C)))
+	defer done()
+	ctx := context.TODO()
+	if err := fs.Put(ctx, "file", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if putChecksum != sum {
+		t.Fatalf("put checksum %q, want %q", putChecksum, sum)
+	}
+
+	stored = sum
+	info, err := fs.(s3fs.ContextualStatFS).StatWithContext(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if algorithm, checksum := info.(s3fs.Checksummer).Checksum(); algorithm != s3fs.ChecksumCRC32C || checksum != sum {
+		t.Fatalf("stat checksum %s %q, want CRC32C %q", algorithm, checksum, sum)
+	}
+	if b, err := fs.ReadFileWithContext(ctx, "file"); err != nil || string(b) != content {
+		t.Fatalf("read %q, %v, want %q", b, err, content)
+	}
+
+	stored = base64.StdEncoding.EncodeToString([]byte{0, 0, 0, 0})
+	if _, err := fs.ReadFileWithContext(ctx, "file"); !errors.Is(err, s3fs.ErrChecksumMismatch) {
+		t.Fatalf("read corrupted file got %v, want ErrChecksumMismatch", err)
+	}
+
+	if _, err := s3fs.New(s3fs.WithChecksum("CRC16"), s3fs.WithNamespace("test-bucket")); err == nil {
+		t.Fatal("New with an unknown checksum should fail")
+	}
+}
+
+// headerOverrider overrides the response header before it's written.
+type headerOverrider struct {
+	http.ResponseWriter
+	key, value string
+}
+
+func (h *headerOverrider) WriteHeader(status int) {
+	h.Header().Set(h.key, h.value)
+	h.ResponseWriter.WriteHeader(status)
+}
+
+func (h *headerOverrider) Write(b []byte) (int, error) {
+	h.Header().Set(h.key, h.value)
+	return h.ResponseWriter.Write(b)
+}
+
+func TestAzureChecksum(t *testing.T) {
+	const content = "hello, checksum"
+	// a blob store keeping the Content-MD5 set by the client only
+	var (
+		mu     sync.Mutex
+		crc64  []string
+		blocks = make(map[string][]byte)
+		blobs  = make(map[string][]byte)
+		md5s   = make(map[string]string)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		b, _ := io.ReadAll(r.Body)
+		switch r.Method {
+		case http.MethodPut:
+			switch r.URL.Query().Get("comp") {
+			case "block":
+				crc64 = append(crc64, r.Header.Get("X-Ms-Content-Crc64"))
+				blocks[r.URL.Query().Get("blockid")] = b
+			case "blocklist":
+				var list struct {
+					Latest []string
+				}
+				if err := xml.Unmarshal(b, &list); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				b = nil
+				for _, id := range list.Latest {
+					b = append(b, blocks[id]...)
+				}
+				fallthrough
+			default:
+				blobs[r.URL.Path], md5s[r.URL.Path] = b, r.Header.Get("X-Ms-Blob-Content-Md5")
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			b, ok := blobs[r.URL.Path]
+			if !ok {
+				w.Header().Set("X-Ms-Error-Code", "BlobNotFound")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if md5s[r.URL.Path] != "" {
+				w.Header().Set("Content-MD5", md5s[r.URL.Path])
+			}
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			w.Write(b)
+		}
+	}))
+	defer ts.Close()
+
+	const key = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	fs, err := s3fs.New(
+		s3fs.WithAzureConnectionString("DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey="+key+";BlobEndpoint="+ts.URL+"/devstoreaccount1;"),
+		s3fs.WithNamespace("container"),
+		s3fs.WithChecksum(s3fs.ChecksumCRC64NVME),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"large": strings.Repeat(content, 1<<17), // by blocks
+		"small": content,                        // at once
+	} {
+		if err := fs.Put(context.TODO(), name, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		path := "/devstoreaccount1/container/" + name
+		mu.Lock()
+		sum := md5.Sum([]byte(content))
+		if got, want := md5s[path], base64.StdEncoding.EncodeToString(sum[:]); got != want {
+			mu.Unlock()
+			t.Fatalf("put %s with Content-MD5 %q, want %q", name, got, want)
+		}
+		mu.Unlock()
+		if b, err := fs.ReadFileWithContext(context.TODO(), name); err != nil || string(b) != content {
+			t.Fatalf("read %s got %d bytes, %v, want %d", name, len(b), err, len(content))
+		}
+
+		mu.Lock()
+		blobs[path][0]++ // corrupted
+		mu.Unlock()
+		if _, err := fs.ReadFileWithContext(context.TODO(), name); !errors.Is(err, s3fs.ErrChecksumMismatch) {
+			t.Fatalf("read corrupted %s got %v, want ErrChecksumMismatch", name, err)
+		}
+	}
+	if len(crc64) == 0 || crc64[0] == "" {
+		t.Fatalf("put with crc64 %q, want transactional crc64", crc64)
+	}
+}
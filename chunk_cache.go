@@ -0,0 +1,147 @@
+package s3fs
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// ChunkCache is an in-memory cache of object chunks, bounded by bytes, which can be shared by many fs.
+//
+// Chunks are keyed by the object's location, name, ETag and chunk index, so opens of the same object share
+// its chunks, while concurrent fetches of the same chunk are de-duplicated. It's safe for concurrent use.
+type ChunkCache struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *chunkEntry, the front is the most recently used.
+	entries map[chunkKey]*list.Element
+	calls   map[chunkKey]*chunkCall
+}
+
+// NewChunkCache creates a chunk cache holding at most maxBytes.
+func NewChunkCache(maxBytes int64) *ChunkCache {
+	return &ChunkCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[chunkKey]*list.Element),
+		calls:    make(map[chunkKey]*chunkCall),
+	}
+}
+
+// WithChunkCache lets opened files share chunks through the cache, it needs a non-zero WithBufferSize.
+//
+// Each open still downloads the first chunk, which tells whether the cached chunks are of the same version.
+func WithChunkCache(cache *ChunkCache) Option {
+	return func(fs *awsS3) {
+		fs.chunkCache = cache
+	}
+}
+
+type chunkKey struct {
+	location string
+	name     string
+	etag     string
+	bufLen   int64
+	index    int64
+}
+
+type chunkEntry struct {
+	key  chunkKey
+	data []byte
+}
+
+// chunkCall is an in-flight fetch of a chunk, which is canceled once all of its waiters left.
+type chunkCall struct {
+	done    chan struct{}
+	data    []byte
+	err     error
+	waiters int // guarded by ChunkCache.mu
+	cancel  context.CancelFunc
+}
+
+// Size returns the bytes held by the cache.
+func (c *ChunkCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// get returns the cached chunk, or fetches it if not cached, in which case fetched is true. The returned bytes
+// must not be modified.
+//
+// Concurrent gets of the same chunk share one fetch, which isn't canceled by the ctx of the get starting it,
+// e.g., its file closed, but once all the gets waiting for it are done.
+func (c *ChunkCache) get(ctx context.Context, key chunkKey, fetch func(ctx context.Context) ([]byte, error)) (data []byte, fetched bool, err error) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*chunkEntry).data, false, nil
+	}
+	call, ok := c.calls[key]
+	if !ok || call.waiters == 0 { // none, or canceled since all left
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &chunkCall{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = call
+		go c.fetch(fetchCtx, key, call, fetch)
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		if call.waiters--; call.waiters == 0 {
+			call.cancel()
+		}
+		c.mu.Unlock()
+		return nil, false, ctx.Err()
+	case <-call.done:
+		return call.data, true, call.err
+	}
+}
+
+// fetch fetches the chunk of the call, and caches it if succeeded.
+func (c *ChunkCache) fetch(ctx context.Context, key chunkKey, call *chunkCall, fetch func(ctx context.Context) ([]byte, error)) {
+	defer call.cancel()
+	data, err := fetch(ctx)
+
+	c.mu.Lock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	if err == nil {
+		c.addLocked(key, data)
+	}
+	call.data, call.err = data, err
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// add puts the chunk into the cache.
+func (c *ChunkCache) add(key chunkKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addLocked(key, data)
+}
+
+func (c *ChunkCache) addLocked(key chunkKey, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&chunkEntry{key: key, data: data})
+	c.size += int64(len(data))
+	for c.size > c.maxBytes {
+		e := c.lru.Back()
+		entry := e.Value.(*chunkEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+}
@@ -0,0 +1,195 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestChunkCache(t *testing.T) {
+	var gets atomic.Int32
+	cache := s3fs.NewChunkCache(1 << 20)
+	fs, done := newTestFs(countGets(&gets), withOptions(s3fs.WithBufferSize(100), s3fs.WithChunkCache(cache)))
+	defer done()
+
+	content := bytes.Repeat([]byte("0123456789"), 100) // 10 chunks
+	if err := fs.Put(context.TODO(), "key", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	const readers = 8
+	gets.Store(0)
+	var wg sync.WaitGroup
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := fs.Open("key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer f.Close()
+			b, err := io.ReadAll(f)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(b, content) {
+				t.Errorf("read %d bytes, want %d", len(b), len(content))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the first chunk per open, the others once
+	if got, want := gets.Load(), int32(readers+9); got != want {
+		t.Fatalf("got %d GETs, want %d", got, want)
+	}
+	if got := cache.Size(); got != int64(len(content)) {
+		t.Fatalf("cache size = %d, want %d", got, len(content))
+	}
+}
+
+func TestChunkCacheLeaderCanceled(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		gets    = make(map[string]int)
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		rng := r.Header.Get("Range")
+		mu.Lock()
+		gets[rng]++
+		mu.Unlock()
+		if rng == "bytes=4-7" { // stalls the shared chunk
+			close(started)
+			select {
+			case <-r.Context().Done():
+				return
+			case <-release:
+			}
+		}
+		next.ServeHTTP(w, r)
+	}), withOptions(s3fs.WithBufferSize(4), s3fs.WithChunkCache(s3fs.NewChunkCache(1<<20))))
+	defer done()
+	const content = "0123456789ab"
+	if err := fs.Put(context.TODO(), "key", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file closed halfway, i.e., its ctx canceled, fetches the chunk shared by the other one
+	ctx, cancel := context.WithCancel(context.TODO())
+	leader, err := fs.OpenWithContext(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer leader.Close()
+	other, err := fs.Open("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(leader)
+		leaderErr <- err
+	}()
+	<-started
+	otherRead := make(chan string, 1)
+	go func() {
+		b, err := io.ReadAll(other)
+		if err != nil {
+			t.Error(err)
+		}
+		otherRead <- string(b)
+	}()
+	time.Sleep(50 * time.Millisecond) // waits for the shared chunk
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("read of the canceled file = %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if b := <-otherRead; b != content {
+		t.Fatalf("read %q, want %q", b, content)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if gets["bytes=4-7"] != 1 {
+		t.Fatalf("GETs %v, want the shared chunk fetched once", gets)
+	}
+}
+
+func TestChunkCacheSharedProgress(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		full    int // the progress events of reads done
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Header.Get("Range") == "bytes=4-7" { // stalls the shared chunk
+			close(started)
+			<-release
+		}
+		next.ServeHTTP(w, r)
+	}), withOptions(s3fs.WithBufferSize(4), s3fs.WithChunkCache(s3fs.NewChunkCache(1<<20)),
+		s3fs.WithProgress(func(p s3fs.Progress) {
+			if p.Op == s3fs.OpRead && p.Bytes == p.Total {
+				mu.Lock()
+				full++
+				mu.Unlock()
+			}
+		})))
+	defer done()
+	const content = "01234567"
+	if err := fs.Put(context.TODO(), "key", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shared chunk counts to the progress of both files
+	read := func(f io.Reader, ch chan<- string) {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- string(b)
+	}
+	first, err := fs.Open("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := fs.Open("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	reads := make(chan string, 2)
+	go read(first, reads)
+	<-started
+	go read(second, reads)
+	time.Sleep(50 * time.Millisecond) // waits for the shared chunk
+	close(release)
+	for range 2 {
+		if b := <-reads; b != content {
+			t.Fatalf("read %q, want %q", b, content)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if full != 2 {
+		t.Fatalf("got %d reads done by the progress, want 2", full)
+	}
+}
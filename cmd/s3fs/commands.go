@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/longkai/s3fs"
+)
+
+// entry is the file info printed by commands.
+type entry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime,omitzero"`
+	ETag    string    `json:"etag,omitempty"`
+	Dir     bool      `json:"dir,omitempty"`
+}
+
+func newEntry(name string, info fs.FileInfo) entry {
+	e := entry{Name: name, Size: info.Size(), ModTime: info.ModTime()}
+	if t, ok := info.(s3fs.ETagger); ok {
+		e.ETag = t.ETag()
+	}
+	return e
+}
+
+func (e entry) String() string {
+	if e.Dir {
+		return fmt.Sprintf("%19s %12s %s", "", "PRE", e.Name)
+	}
+	return fmt.Sprintf("%19s %12d %s", e.ModTime.Local().Format(time.DateTime), e.Size, e.Name)
+}
+
+// print prints v as a json line in json mode, otherwise as text.
+func (c *cli) print(v fmt.Stringer) error {
+	if c.json {
+		return json.NewEncoder(c.stdout).Encode(v)
+	}
+	_, err := fmt.Fprintln(c.stdout, v)
+	return err
+}
+
+func (c *cli) ls(ctx context.Context, args []string) error {
+	fl := c.flags("ls", "[-r] <url>")
+	recursive := fl.Bool("r", false, "list recursively")
+	if err := parse(fl, args, 1); err != nil {
+		return err
+	}
+	t, err := resolve(fl.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	l, ok := t.fsys.(s3fs.ListFS)
+	if !ok {
+		return fmt.Errorf("%T can't list files", t.fsys)
+	}
+	if d, ok := t.fsys.(s3fs.ListDirFS); ok && !*recursive {
+		err := d.ListDir(ctx, t.key, func(info fs.FileInfo) error {
+			if info.IsDir() {
+				return c.print(entry{Name: info.Name() + "/", Dir: true})
+			}
+			return c.print(newEntry(info.Name(), info))
+		})
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+	// collapses the files under dirs if the fs can't list dirs
+	dirs := make(map[string]bool)
+	return l.List(ctx, t.key, func(info fs.FileInfo) error {
+		name := info.Name()
+		if i := strings.Index(name[len(t.key):], "/"); !*recursive && i >= 0 {
+			dir := name[:len(t.key)+i+1]
+			if dirs[dir] {
+				return nil
+			}
+			dirs[dir] = true
+			return c.print(entry{Name: dir, Dir: true})
+		}
+		return c.print(newEntry(name, info))
+	})
+}
+
+func (c *cli) cat(ctx context.Context, args []string) error {
+	fl := c.flags("cat", "[-range a-b] <url>")
+	rng := fl.String("range", "", `the byte range like http, i.e., "a-b" (inclusive), "a-" or "-n" for the last n bytes`)
+	if err := parse(fl, args, 1); err != nil {
+		return err
+	}
+	t, err := resolve(fl.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	if *rng == "" {
+		r, err := open(ctx, t)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(c.stdout, r)
+		return err
+	}
+
+	offset, length, err := parseRange(*rng)
+	if err != nil {
+		return err
+	}
+	if offset < 0 { // suffix
+		info, err := statFile(ctx, t)
+		if err != nil {
+			return err
+		}
+		offset = max(info.Size()-length, 0)
+		length = info.Size() - offset
+	}
+	r, ok := t.fsys.(s3fs.RangeReadFS)
+	if !ok {
+		return fmt.Errorf("%T can't read ranges", t.fsys)
+	}
+	rc, err := r.ReadRange(ctx, t.key, offset, length)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(c.stdout, rc)
+	return err
+}
+
+// parseRange parses the byte range "a-b", "a-" or "-n", a negative offset means the last length bytes.
+func parseRange(s string) (offset, length int64, err error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok || first == "" && last == "" {
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	var start, end int64 = -1, -1
+	if first != "" {
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 {
+			return 0, 0, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < 0 {
+			return 0, 0, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	switch {
+	case start < 0:
+		return -1, end, nil
+	case end < 0:
+		return start, -1, nil
+	case end < start:
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	return start, end - start + 1, nil
+}
+
+// copied is the result of cp.
+type copied struct {
+	Src  string `json:"src"`
+	Dst  string `json:"dst"`
+	Size int64  `json:"size"`
+}
+
+func (c copied) String() string {
+	return fmt.Sprintf("copy: %s to %s (%d bytes)", c.Src, c.Dst, c.Size)
+}
+
+func (c *cli) cp(ctx context.Context, args []string) error {
+	fl := c.flags("cp", "<src> <dst>")
+	if err := parse(fl, args, 2); err != nil {
+		return err
+	}
+	src, dst := fl.Arg(0), fl.Arg(1)
+
+	var r io.Reader = c.stdin
+	name := "-"
+	if src != "-" {
+		t, err := resolve(src, false)
+		if err != nil {
+			return err
+		}
+		rc, err := open(ctx, t)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		r, name = rc, t.key
+	}
+	cr := &countingReader{r: r}
+
+	if dst == "-" {
+		_, err := io.Copy(c.stdout, cr)
+		return err
+	}
+	t, err := resolve(dst, false)
+	if err != nil {
+		return err
+	}
+	if t.key == "" || strings.HasSuffix(t.key, "/") {
+		if name == "-" {
+			return errors.New("cp: missing the dst file name for stdin")
+		}
+		t.key += path.Base(name)
+	}
+	if err := t.fsys.Put(ctx, t.key, cr); err != nil {
+		return err
+	}
+	return c.print(copied{Src: src, Dst: dst, Size: cr.n})
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// deleted is the result of rm.
+type deleted struct {
+	Name string `json:"name"`
+}
+
+func (d deleted) String() string { return "delete: " + d.Name }
+
+func (c *cli) rm(ctx context.Context, args []string) error {
+	fl := c.flags("rm", "[-r] <url>")
+	recursive := fl.Bool("r", false, "remove all the files with the prefix")
+	if err := parse(fl, args, 1); err != nil {
+		return err
+	}
+	t, err := resolve(fl.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	if !*recursive {
+		if err := t.fsys.Delete(ctx, t.key); err != nil {
+			return err
+		}
+		return c.print(deleted{t.key})
+	}
+	l, ok := t.fsys.(s3fs.ListFS)
+	if !ok {
+		return fmt.Errorf("%T can't list files", t.fsys)
+	}
+	var names []string
+	if err := l.List(ctx, t.key, func(info fs.FileInfo) error {
+		names = append(names, info.Name())
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := t.fsys.Delete(ctx, name); err != nil {
+			return err
+		}
+		if err := c.print(deleted{name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// info is the result of stat.
+type info entry
+
+func (i info) String() string {
+	return fmt.Sprintf("Name: %s\nSize: %d\nModTime: %s\nETag: %s", i.Name, i.Size, i.ModTime.Format(time.RFC3339), i.ETag)
+}
+
+func (c *cli) stat(ctx context.Context, args []string) error {
+	fl := c.flags("stat", "<url>")
+	if err := parse(fl, args, 1); err != nil {
+		return err
+	}
+	t, err := resolve(fl.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	fi, err := statFile(ctx, t)
+	if err != nil {
+		return err
+	}
+	return c.print(info(newEntry(t.key, fi)))
+}
+
+// presigned is the result of presign.
+type presigned struct {
+	Method  string    `json:"method"`
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+func (p presigned) String() string { return p.URL }
+
+func (c *cli) presign(ctx context.Context, args []string) error {
+	fl := c.flags("presign", "[-put] [-expires d] <url>")
+	put := fl.Bool("put", false, "presign an upload rather than a download")
+	expires := fl.Duration("expires", 15*time.Minute, "the expiry of the url")
+	if err := parse(fl, args, 1); err != nil {
+		return err
+	}
+	t, err := resolve(fl.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	p, ok := t.fsys.(s3fs.PresignFS)
+	if !ok {
+		return fmt.Errorf("%T can't presign", t.fsys)
+	}
+	withExpires := func(o *s3.PresignOptions) { o.Expires = *expires }
+	ret := presigned{Method: "GET", Expires: time.Now().Add(*expires)}
+	if *put {
+		ret.Method = "PUT"
+		ret.URL, err = p.PresignPut(ctx, t.key, withExpires)
+	} else {
+		ret.URL, err = p.PresignGet(ctx, t.key, withExpires)
+	}
+	if err != nil {
+		return err
+	}
+	return c.print(ret)
+}
+
+// synced is the result of sync.
+type synced struct {
+	DryRun    bool              `json:"dryRun,omitempty"`
+	Copied    []string          `json:"copied"`
+	Deleted   []string          `json:"deleted"`
+	Unchanged int               `json:"unchanged"`
+	Bytes     int64             `json:"bytes"`
+	Failed    map[string]string `json:"failed,omitempty"`
+}
+
+func (s synced) String() string {
+	var b strings.Builder
+	prefix := ""
+	if s.DryRun {
+		prefix = "(dryrun) "
+	}
+	for _, name := range s.Copied {
+		fmt.Fprintf(&b, "%scopy: %s\n", prefix, name)
+	}
+	for _, name := range s.Deleted {
+		fmt.Fprintf(&b, "%sdelete: %s\n", prefix, name)
+	}
+	for name, err := range s.Failed {
+		fmt.Fprintf(&b, "failed: %s: %s\n", name, err)
+	}
+	fmt.Fprintf(&b, "%d copied (%d bytes), %d deleted, %d unchanged, %d failed",
+		len(s.Copied), s.Bytes, len(s.Deleted), s.Unchanged, len(s.Failed))
+	return b.String()
+}
+
+func (c *cli) sync(ctx context.Context, args []string) error {
+	fl := c.flags("sync", "[-delete] [-dry-run] [-compare size|etag|hash] [-concurrency n] <src> <dst>")
+	del := fl.Bool("delete", false, "delete the dst files which don't exist in src")
+	dryRun := fl.Bool("dry-run", false, "print what would be done without doing it")
+	compare := fl.String("compare", "size", "compare files by size and modification time, etag, or content hash")
+	concurrency := fl.Int("concurrency", 8, "the max number of files copied at the same time")
+	if err := parse(fl, args, 2); err != nil {
+		return err
+	}
+	opts := []s3fs.SyncOption{s3fs.WithSyncConcurrency(*concurrency)}
+	switch *compare {
+	case "size":
+	case "etag":
+		opts = append(opts, s3fs.WithSyncCompare(s3fs.SyncByETag))
+	case "hash":
+		opts = append(opts, s3fs.WithSyncCompare(s3fs.SyncByHash))
+	default:
+		return fmt.Errorf("sync: unknown compare %q", *compare)
+	}
+	if *del {
+		opts = append(opts, s3fs.WithSyncDelete())
+	}
+	if *dryRun {
+		opts = append(opts, s3fs.WithSyncDryRun())
+	}
+
+	src, dst, err := resolvePair(fl.Arg(0), fl.Arg(1))
+	if err != nil {
+		return err
+	}
+	var res *s3fs.SyncResult
+	if src.key == dst.key {
+		// the same layout, keeps the fs as is, which may copy within the service
+		res, err = s3fs.Sync(ctx, src.fsys, dst.fsys, src.key, opts...)
+	} else {
+		res, err = s3fs.Sync(ctx, sub(src.fsys, src.key), sub(dst.fsys, dst.key), "", opts...)
+	}
+	if res == nil {
+		return err
+	}
+	out := synced{
+		DryRun:    *dryRun,
+		Copied:    res.Copied,
+		Deleted:   res.Deleted,
+		Unchanged: res.Unchanged,
+		Bytes:     res.Bytes,
+		Failed:    make(map[string]string),
+	}
+	for name, err := range res.Failed {
+		out.Failed[name] = err.Error()
+	}
+	if perr := c.print(out); perr != nil {
+		return perr
+	}
+	if err != nil {
+		return fmt.Errorf("sync: %d files failed", len(res.Failed))
+	}
+	return nil
+}
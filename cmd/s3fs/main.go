@@ -0,0 +1,116 @@
+// Command s3fs accesses files of aws s3 compatible object storages, azure blob and local dirs by urls.
+//
+// Usage:
+//
+//	s3fs <command> [flags] <url>...
+//
+// Commands:
+//
+//	ls [-r] <url>                      list files with the prefix, one level unless -r
+//	cat [-range a-b] <url>             print the file, or the byte range of it
+//	cp <src> <dst>                     copy the file, "-" means stdin or stdout
+//	rm [-r] <url>                      remove the file, or all the files with the prefix if -r
+//	stat <url>                         print the file info
+//	presign [-put] [-expires d] <url>  print a presigned url of the file
+//	sync [flags] <src> <dst>           mirror the files under the src prefix to the dst prefix
+//
+// Every command accepts -json to print json lines instead of text.
+//
+// Urls are the ones supported by s3fs.FromURL, and local paths. Credentials are read from the env vars:
+//   - aws: the default chain, e.g., AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_PROFILE;
+//     AWS_REGION and AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) apply to s3:// urls without region or endpoint
+//   - azure: AZURE_STORAGE_ACCOUNT for az:// urls without account, AZURE_STORAGE_KEY,
+//     otherwise the default azure credential chain
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	if err := c.run(ctx, os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "s3fs:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+const usage = `usage: s3fs <command> [flags] <url>...
+
+commands:
+  ls [-r] <url>                      list files with the prefix, one level unless -r
+  cat [-range a-b] <url>             print the file, or the byte range of it
+  cp <src> <dst>                     copy the file, "-" means stdin or stdout
+  rm [-r] <url>                      remove the file, or all the files with the prefix if -r
+  stat <url>                         print the file info
+  presign [-put] [-expires d] <url>  print a presigned url of the file
+  sync [flags] <src> <dst>           mirror the files under the src prefix to the dst prefix
+
+run "s3fs <command> -h" for the flags of the command.
+`
+
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+
+	json bool
+}
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usage)
+		return flag.ErrHelp
+	}
+	cmds := map[string]func(context.Context, []string) error{
+		"ls":      c.ls,
+		"cat":     c.cat,
+		"cp":      c.cp,
+		"rm":      c.rm,
+		"stat":    c.stat,
+		"presign": c.presign,
+		"sync":    c.sync,
+	}
+	cmd, ok := cmds[args[0]]
+	if !ok {
+		fmt.Fprint(c.stderr, usage)
+		if args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+			return flag.ErrHelp
+		}
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd(ctx, args[1:])
+}
+
+// flags creates the flag set of the command, with the common -json flag.
+func (c *cli) flags(name, usage string) *flag.FlagSet {
+	fl := flag.NewFlagSet(name, flag.ContinueOnError)
+	fl.SetOutput(c.stderr)
+	fl.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: s3fs %s %s\n", name, usage)
+		fl.PrintDefaults()
+	}
+	fl.BoolVar(&c.json, "json", false, "print json lines")
+	return fl
+}
+
+// parse parses the flags and checks the number of args.
+func parse(fl *flag.FlagSet, args []string, nargs int) error {
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() != nargs {
+		fl.Usage()
+		return fmt.Errorf("%s: want %d args, got %d", fl.Name(), nargs, fl.NArg())
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+func newTestServer(t *testing.T, middlewares ...func(http.Handler) http.Handler) string {
+	t.Helper()
+	handler := gofakes3.New(s3mem.New(), gofakes3.WithAutoBucket(true)).Server()
+	for _, m := range middlewares {
+		handler = m(handler)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AK******")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SK******")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_ENDPOINT_URL_S3", ts.URL)
+	return ts.URL
+}
+
+func run(t *testing.T, stdin string, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	if err := c.run(context.TODO(), args); err != nil {
+		t.Fatalf("s3fs %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestCLI(t *testing.T) {
+	newTestServer(t)
+	dir := t.TempDir()
+	local := filepath.Join(dir, "hello.txt")
+	if err := os.WriteFile(local, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, "", "cp", local, "s3://bucket/data/")
+	run(t, "from stdin", "cp", "-", "s3://bucket/data/sub/stdin.txt")
+	run(t, "", "cp", "s3://bucket/data/hello.txt", "s3://bucket/backup/hello.txt")
+
+	if got := run(t, "", "cat", "s3://bucket/data/hello.txt"); got != "hello world" {
+		t.Fatalf("cat = %q, want %q", got, "hello world")
+	}
+	for rng, want := range map[string]string{"0-4": "hello", "6-": "world", "-3": "rld"} {
+		if got := run(t, "", "cat", "-range", rng, "s3://bucket/data/hello.txt"); got != want {
+			t.Fatalf("cat -range %s = %q, want %q", rng, got, want)
+		}
+	}
+	if got := run(t, "", "cp", "s3://bucket/data/sub/stdin.txt", "-"); got != "from stdin" {
+		t.Fatalf("cp to stdout = %q, want %q", got, "from stdin")
+	}
+
+	var st entry
+	if err := json.Unmarshal([]byte(run(t, "", "stat", "-json", "s3://bucket/data/hello.txt")), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Name != "data/hello.txt" || st.Size != 11 || st.ETag == "" {
+		t.Fatalf("stat = %+v", st)
+	}
+
+	ls := run(t, "", "ls", "s3://bucket/data/")
+	if !strings.Contains(ls, "data/hello.txt") || !strings.Contains(ls, "PRE data/sub/") || strings.Contains(ls, "stdin.txt") {
+		t.Fatalf("ls =\n%s", ls)
+	}
+	ls = run(t, "", "ls", "-r", "-json", "s3://bucket/")
+	if n := strings.Count(ls, "\n"); n != 3 {
+		t.Fatalf("ls -r got %d files, want 3:\n%s", n, ls)
+	}
+
+	if got := run(t, "", "presign", "s3://bucket/data/hello.txt"); !strings.Contains(got, "X-Amz-Signature=") {
+		t.Fatalf("presign = %q", got)
+	}
+
+	mirror := filepath.Join(dir, "mirror")
+	run(t, "", "sync", "s3://bucket/data", mirror)
+	if b, err := os.ReadFile(filepath.Join(mirror, "sub", "stdin.txt")); err != nil || string(b) != "from stdin" {
+		t.Fatalf("synced file = %q, %v", b, err)
+	}
+	var res synced
+	if err := json.Unmarshal([]byte(run(t, "", "sync", "-json", "-delete", "s3://bucket/backup/", mirror)), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Deleted) != 1 || res.Deleted[0] != "sub/stdin.txt" || res.Unchanged != 1 {
+		t.Fatalf("sync = %+v", res)
+	}
+
+	run(t, "", "rm", "-r", "s3://bucket/data/")
+	if ls := run(t, "", "ls", "-r", "s3://bucket/"); strings.Contains(ls, "data/") {
+		t.Fatalf("ls after rm -r =\n%s", ls)
+	}
+}
+
+func TestSyncCopy(t *testing.T) {
+	var copies atomic.Int32
+	newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Amz-Copy-Source") != "" {
+				copies.Add(1)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	run(t, "hello", "cp", "-", "s3://bucket/data/a.txt")
+	run(t, "world", "cp", "-", "s3://bucket/data/sub/b.txt")
+
+	for i, dst := range []string{"s3://bucket/backup/", "s3://other/", "s3://other/data/"} {
+		run(t, "", "sync", "s3://bucket/data/", dst)
+		if got := run(t, "", "cat", dst+"sub/b.txt"); got != "world" {
+			t.Fatalf("synced to %s = %q", dst, got)
+		}
+		if n := copies.Load(); n != int32(2*(i+1)) {
+			t.Fatalf("sync to %s made %d copies in total, want files copied within the service", dst, n)
+		}
+	}
+}
+
+func TestLsDelimiter(t *testing.T) {
+	var delimited, listed atomic.Int32
+	newTestServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("list-type") == "2" {
+				listed.Add(1)
+				if r.URL.Query().Get("delimiter") == "/" {
+					delimited.Add(1)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	run(t, "hello", "cp", "-", "s3://bucket/data/a.txt")
+	run(t, "world", "cp", "-", "s3://bucket/data/sub/b.txt")
+	run(t, "world", "cp", "-", "s3://bucket/data/sub/c.txt")
+
+	listed.Store(0)
+	ls := run(t, "", "ls", "s3://bucket/data/")
+	if want := "PRE data/sub/"; strings.Count(ls, want) != 1 || !strings.Contains(ls, "data/a.txt") || strings.Contains(ls, "b.txt") {
+		t.Fatalf("ls =\n%s", ls)
+	}
+	if listed.Load() != 1 || delimited.Load() != 1 {
+		t.Fatalf("ls made %d lists, %d delimited, want the dir listed by the delimiter", listed.Load(), delimited.Load())
+	}
+
+	local := t.TempDir()
+	run(t, "", "sync", "s3://bucket/data/", local)
+	ls = run(t, "", "ls", local+string(filepath.Separator))
+	if !strings.Contains(ls, "PRE sub/") || !strings.Contains(ls, "a.txt") || strings.Contains(ls, "b.txt") {
+		t.Fatalf("ls of local dir =\n%s", ls)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, tt := range []struct {
+		in             string
+		offset, length int64
+		err            bool
+	}{
+		{in: "0-9", offset: 0, length: 10},
+		{in: "5-", offset: 5, length: -1},
+		{in: "-5", offset: -1, length: 5},
+		{in: "9-0", err: true},
+		{in: "-", err: true},
+		{in: "a-b", err: true},
+	} {
+		offset, length, err := parseRange(tt.in)
+		if (err != nil) != tt.err || offset != tt.offset || length != tt.length {
+			t.Errorf("parseRange(%q) = %d, %d, %v", tt.in, offset, length, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/longkai/s3fs"
+)
+
+// target is a file or a prefix of files in a fs.
+type target struct {
+	fsys s3fs.FS
+	key  string
+}
+
+// resolve resolves the url or local path to the fs and the key in it.
+// Local dirs, and local paths if dir is set, are resolved to the fs of the dir with the empty key.
+func resolve(arg string, dir bool) (*target, error) {
+	u, err := url.Parse(arg)
+	if err != nil || len(u.Scheme) < 2 { // not a url, or a windows drive
+		if fi, err := os.Stat(arg); dir || strings.HasSuffix(arg, string(filepath.Separator)) || err == nil && fi.IsDir() {
+			return &target{fsys: s3fs.DirFS(arg)}, nil
+		}
+		return &target{fsys: s3fs.DirFS(filepath.Dir(arg)), key: filepath.Base(arg)}, nil
+	}
+
+	opts := withEnv(u)
+	fsys, key, err := s3fs.FromURL(u.String(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if dir && key != "" && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	return &target{fsys: fsys, key: key}, nil
+}
+
+// resolvePair resolves the src and dst dirs, the dst shares the fs of the src if both are buckets of the same
+// s3 service, so that files are copied within the service.
+func resolvePair(srcArg, dstArg string) (src, dst *target, err error) {
+	if src, err = resolve(srcArg, true); err != nil {
+		return nil, nil, err
+	}
+	if dst, err = resolve(dstArg, true); err != nil {
+		return nil, nil, err
+	}
+	su, err1 := url.Parse(srcArg)
+	du, err2 := url.Parse(dstArg)
+	if err1 == nil && err2 == nil && su.Scheme == "s3" && du.Scheme == "s3" && su.RawQuery == du.RawQuery {
+		if n, ok := src.fsys.(s3fs.NamespacedFS); ok {
+			dst.fsys = n.Namespace(du.Host)
+		}
+	}
+	return src, dst, nil
+}
+
+// withEnv fills the url with the settings from the env vars, and returns the options of the credentials.
+func withEnv(u *url.URL) []s3fs.Option {
+	q := u.Query()
+	switch u.Scheme {
+	case "s3":
+		if region := cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")); q.Get("region") == "" && region != "" {
+			q.Set("region", region)
+		}
+		if endpoint := cmp.Or(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")); q.Get("endpoint") == "" && endpoint != "" {
+			q.Set("endpoint", endpoint)
+		}
+		u.RawQuery = q.Encode()
+	case "az":
+		account := cmp.Or(q.Get("account"), os.Getenv("AZURE_STORAGE_ACCOUNT"))
+		if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" && account != "" {
+			return []s3fs.Option{s3fs.WithCredential(account, key)}
+		}
+	case "http", "https":
+		account, _, ok := strings.Cut(u.Hostname(), ".blob.core.")
+		if key := os.Getenv("AZURE_STORAGE_KEY"); ok && key != "" {
+			return []s3fs.Option{s3fs.WithCredential(account, key)}
+		}
+	}
+	return nil
+}
+
+// open opens the file for sequential reading, which streams the content if the fs can read ranges.
+func open(ctx context.Context, t *target) (io.ReadCloser, error) {
+	if r, ok := t.fsys.(s3fs.RangeReadFS); ok {
+		return r.ReadRange(ctx, t.key, 0, -1)
+	}
+	return t.fsys.OpenWithContext(ctx, t.key)
+}
+
+// statFile gets the file info, by opening the file if the fs can't stat.
+func statFile(ctx context.Context, t *target) (fs.FileInfo, error) {
+	if s, ok := t.fsys.(s3fs.ContextualStatFS); ok {
+		return s.StatWithContext(ctx, t.key)
+	}
+	f, err := t.fsys.OpenWithContext(ctx, t.key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// subFS is the fs of the files under the dir of the parent fs, like fs.Sub.
+type subFS struct {
+	s3fs.FS
+	dir string
+}
+
+// sub returns the fs of the dir, even if empty, so that subFS of the same service copy files between them.
+func sub(fsys s3fs.FS, dir string) s3fs.FS {
+	return &subFS{FS: fsys, dir: dir}
+}
+
+func (s *subFS) Open(name string) (fs.File, error) { return s.FS.Open(s.dir + name) }
+
+func (s *subFS) OpenWithContext(ctx context.Context, name string) (fs.File, error) {
+	return s.FS.OpenWithContext(ctx, s.dir+name)
+}
+
+func (s *subFS) ReadFile(name string) ([]byte, error) { return s.FS.ReadFile(s.dir + name) }
+
+func (s *subFS) ReadFileWithContext(ctx context.Context, name string) ([]byte, error) {
+	return s.FS.ReadFileWithContext(ctx, s.dir+name)
+}
+
+func (s *subFS) Put(ctx context.Context, name string, reader io.Reader) error {
+	return s.FS.Put(ctx, s.dir+name, reader)
+}
+
+func (s *subFS) Delete(ctx context.Context, name string) error {
+	return s.FS.Delete(ctx, s.dir+name)
+}
+
+func (s *subFS) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	if r, ok := s.FS.(s3fs.RangeReadFS); ok {
+		return r.ReadRange(ctx, s.dir+name, offset, length)
+	}
+	if offset == 0 && length < 0 {
+		return s.OpenWithContext(ctx, name)
+	}
+	return nil, fmt.Errorf("%T can't read ranges", s.FS)
+}
+
+func (s *subFS) CopyFrom(ctx context.Context, src s3fs.FS, srcName, name string, size int64) error {
+	c, ok := s.FS.(s3fs.CopyFS)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	if sub, ok := src.(*subFS); ok {
+		src, srcName = sub.FS, sub.dir+srcName
+	}
+	return c.CopyFrom(ctx, src, srcName, s.dir+name, size)
+}
+
+func (s *subFS) List(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error {
+	l, ok := s.FS.(s3fs.ListFS)
+	if !ok {
+		return fmt.Errorf("%T can't list files", s.FS)
+	}
+	return l.List(ctx, s.dir+prefix, func(info fs.FileInfo) error {
+		return fn(subInfo{info, strings.TrimPrefix(info.Name(), s.dir)})
+	})
+}
+
+// ListDir returns errors.ErrUnsupported if the parent fs can't list dirs.
+func (s *subFS) ListDir(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error {
+	l, ok := s.FS.(s3fs.ListDirFS)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return l.ListDir(ctx, s.dir+prefix, func(info fs.FileInfo) error {
+		return fn(subInfo{info, strings.TrimPrefix(info.Name(), s.dir)})
+	})
+}
+
+// subInfo renames the file info relative to the dir of subFS.
+type subInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i subInfo) Name() string { return i.name }
+
+func (i subInfo) ETag() string {
+	if e, ok := i.FileInfo.(s3fs.ETagger); ok {
+		return e.ETag()
+	}
+	return ""
+}
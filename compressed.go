@@ -0,0 +1,263 @@
+package s3fs
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	_ ContextualStatFS = (*compressedFs)(nil)
+	_ ListFS           = (*compressedFs)(nil)
+	_ MetadataFS       = (*compressedFs)(nil)
+)
+
+// The content encodings supported by Compressed.
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// CompressOption configures the fs returned by Compressed.
+type CompressOption func(c *compressedFs)
+
+// WithCompressEncoding sets the encoding of files matching no extensions or content types, defaults to gzip.
+// The empty encoding stores them as is.
+func WithCompressEncoding(encoding string) CompressOption {
+	return func(c *compressedFs) {
+		c.encoding = encoding
+	}
+}
+
+// WithCompressExtensions sets the encoding of files by their extensions, e.g., ".ndjson", which takes precedence
+// over content types. The empty encoding stores them as is, e.g., for ".jpg" compressed already.
+func WithCompressExtensions(encoding string, exts ...string) CompressOption {
+	return func(c *compressedFs) {
+		for _, ext := range exts {
+			c.exts[strings.ToLower(ext)] = encoding
+		}
+	}
+}
+
+// WithCompressContentTypes sets the encoding of files by their content types, e.g., "application/x-ndjson".
+// The content type is the one put by PutWithMetadata, or detected by the extension.
+func WithCompressContentTypes(encoding string, contentTypes ...string) CompressOption {
+	return func(c *compressedFs) {
+		for _, t := range contentTypes {
+			c.contentTypes[strings.ToLower(t)] = encoding
+		}
+	}
+}
+
+// Compressed wraps the fs to compress files on Put and set their Content-Encoding, then to decompress files
+// transparently on Open and ReadFile by the Content-Encoding they are stored with, i.e., gzip or zstd.
+// Files of other encodings are read as is. The fs must be a MetadataFS and a ContextualStatFS, e.g., aws s3 or azure blob.
+//
+// Note sizes reported by Stat and List are of the stored files, i.e., compressed, and files opened can't seek.
+func Compressed(fsys FS, options ...CompressOption) FS {
+	c := &compressedFs{
+		fsys:         fsys,
+		encoding:     EncodingGzip,
+		exts:         make(map[string]string),
+		contentTypes: make(map[string]string),
+	}
+	for _, op := range options {
+		op(c)
+	}
+	return c
+}
+
+type compressedFs struct {
+	fsys         FS
+	encoding     string
+	exts         map[string]string
+	contentTypes map[string]string
+}
+
+// encodingOf returns the encoding of the file to put.
+func (c *compressedFs) encodingOf(name, contentType string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if encoding, ok := c.exts[ext]; ok {
+		return encoding
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(ext)
+	}
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		if encoding, ok := c.contentTypes[t]; ok {
+			return encoding
+		}
+	}
+	return c.encoding
+}
+
+// Put implements FS.
+func (c *compressedFs) Put(ctx context.Context, name string, reader io.Reader) error {
+	return c.PutWithMetadata(ctx, name, reader, Metadata{})
+}
+
+// PutWithMetadata implements MetadataFS, the Content-Encoding of the metadata is overridden if compressed.
+func (c *compressedFs) PutWithMetadata(ctx context.Context, name string, reader io.Reader, metadata Metadata) error {
+	m, ok := c.fsys.(MetadataFS)
+	if !ok {
+		return fmt.Errorf("s3fs: compressed fs without metadata: %w", errors.ErrUnsupported)
+	}
+	encoding := c.encodingOf(name, metadata.ContentType)
+	if encoding == "" {
+		return m.PutWithMetadata(ctx, name, reader, metadata)
+	}
+	if encoding != EncodingGzip && encoding != EncodingZstd {
+		return fmt.Errorf("s3fs: unsupported content encoding %q", encoding)
+	}
+	if metadata.ContentType == "" {
+		metadata.ContentType = mime.TypeByExtension(path.Ext(name))
+	}
+	metadata.ContentEncoding = encoding
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(compress(pw, reader, encoding))
+	}()
+	err := m.PutWithMetadata(ctx, name, pr, metadata)
+	pr.Close() // stops compressing if failed halfway
+	<-done
+	return err
+}
+
+// compress writes the compressed content of the reader to w.
+func compress(w io.Writer, r io.Reader, encoding string) error {
+	var zw io.WriteCloser
+	switch encoding {
+	case EncodingGzip:
+		zw = gzip.NewWriter(w)
+	case EncodingZstd:
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		zw = enc
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// Delete implements FS.
+func (c *compressedFs) Delete(ctx context.Context, name string) error {
+	return c.fsys.Delete(ctx, name)
+}
+
+// Stat implements ContextualStatFS.
+func (c *compressedFs) Stat(name string) (fs.FileInfo, error) {
+	return c.StatWithContext(context.Background(), name)
+}
+
+// StatWithContext implements ContextualStatFS.
+func (c *compressedFs) StatWithContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	s, ok := c.fsys.(ContextualStatFS)
+	if !ok {
+		return nil, fmt.Errorf("s3fs: compressed fs without stat: %w", errors.ErrUnsupported)
+	}
+	return s.StatWithContext(ctx, name)
+}
+
+// List implements ListFS.
+func (c *compressedFs) List(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error {
+	l, ok := c.fsys.(ListFS)
+	if !ok {
+		return fmt.Errorf("s3fs: compressed fs without list: %w", errors.ErrUnsupported)
+	}
+	return l.List(ctx, prefix, fn)
+}
+
+// Open implements FS.
+func (c *compressedFs) Open(name string) (fs.File, error) {
+	return c.OpenWithContext(context.Background(), name)
+}
+
+// OpenWithContext implements FS.
+func (c *compressedFs) OpenWithContext(ctx context.Context, name string) (fs.File, error) {
+	info, err := c.StatWithContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var encoding string
+	if m, ok := info.(MetadataInfo); ok {
+		encoding = strings.ToLower(m.Metadata().ContentEncoding)
+	}
+	var rc io.ReadCloser
+	if rr, ok := c.fsys.(RangeReadFS); ok {
+		rc, err = rr.ReadRange(ctx, name, 0, -1)
+	} else {
+		rc, err = c.fsys.OpenWithContext(ctx, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &compressedFile{rc: rc, info: info}
+	switch encoding {
+	case EncodingGzip:
+		f.r, err = gzip.NewReader(rc)
+	case EncodingZstd:
+		var dec *zstd.Decoder
+		if dec, err = zstd.NewReader(rc); err == nil {
+			f.r, f.dec = dec, dec
+		}
+	default:
+		f.r = rc
+	}
+	if err != nil {
+		rc.Close()
+		return nil, &fs.PathError{Op: "decompress", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// ReadFile implements FS.
+func (c *compressedFs) ReadFile(name string) ([]byte, error) {
+	return c.ReadFileWithContext(context.Background(), name)
+}
+
+// ReadFileWithContext implements FS.
+func (c *compressedFs) ReadFileWithContext(ctx context.Context, name string) ([]byte, error) {
+	f, err := c.OpenWithContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// compressedFile reads the decompressed content of a file.
+type compressedFile struct {
+	r    io.Reader
+	rc   io.ReadCloser
+	dec  *zstd.Decoder // released on Close
+	info fs.FileInfo
+}
+
+// Read implements fs.File.
+func (f *compressedFile) Read(b []byte) (int, error) { return f.r.Read(b) }
+
+// Stat implements fs.File.
+func (f *compressedFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Close implements fs.File.
+func (f *compressedFile) Close() error {
+	if f.dec != nil {
+		f.dec.Close()
+	}
+	return f.rc.Close()
+}
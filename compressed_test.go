@@ -0,0 +1,146 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestCompressed(t *testing.T) {
+	remote, done := newTestFs()
+	defer done()
+	c := s3fs.Compressed(remote,
+		s3fs.WithCompressExtensions(s3fs.EncodingZstd, ".zst-me"),
+		s3fs.WithCompressExtensions("", ".jpg"),
+		s3fs.WithCompressContentTypes(s3fs.EncodingZstd, "text/csv"),
+	)
+	ctx := context.TODO()
+	content := strings.Repeat(`{"level":"info","msg":"hello"}`+"\n", 1000)
+
+	for _, tc := range []struct {
+		name     string
+		encoding string
+	}{
+		{"logs.ndjson", s3fs.EncodingGzip},
+		{"logs.zst-me", s3fs.EncodingZstd},
+		{"table.csv", s3fs.EncodingZstd},
+		{"photo.jpg", ""},
+	} {
+		if err := c.Put(ctx, tc.name, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		info, err := remote.(s3fs.ContextualStatFS).StatWithContext(ctx, tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.(s3fs.MetadataInfo).Metadata().ContentEncoding; got != tc.encoding {
+			t.Fatalf("%s: got Content-Encoding %q, want %q", tc.name, got, tc.encoding)
+		}
+		if tc.encoding != "" && info.Size() >= int64(len(content)) {
+			t.Fatalf("%s: stored %d bytes, want compressed", tc.name, info.Size())
+		}
+		b, err := c.ReadFileWithContext(ctx, tc.name)
+		if err != nil || string(b) != content {
+			t.Fatalf("%s: read %d bytes, %v, want %d bytes", tc.name, len(b), err, len(content))
+		}
+	}
+
+	// files put by others, e.g., gzipped by hand
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(content))
+	zw.Close()
+	err := remote.(s3fs.MetadataFS).PutWithMetadata(ctx, "other.log", &buf, s3fs.Metadata{ContentEncoding: "gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := c.OpenWithContext(ctx, "other.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil || string(b) != content {
+		t.Fatalf("read %d bytes, %v, want %d bytes", len(b), err, len(content))
+	}
+}
+
+func TestCompressedAzure(t *testing.T) {
+	// a blob store serving blobs as stored along with their Content-Encoding, like azure does
+	var (
+		mu        sync.Mutex
+		blobs     = make(map[string][]byte)
+		encodings = make(map[string]string)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			blobs[r.URL.Path], encodings[r.URL.Path] = b, r.Header.Get("X-Ms-Blob-Content-Encoding")
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet, http.MethodHead:
+			b, ok := blobs[r.URL.Path]
+			if !ok {
+				w.Header().Set("X-Ms-Error-Code", "BlobNotFound")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Encoding", encodings[r.URL.Path])
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			w.Header().Set("Etag", `"0x1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			if r.Method == http.MethodGet {
+				w.Write(b)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	const key = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	remote, err := s3fs.New(
+		s3fs.WithAzureConnectionString("DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey="+key+";BlobEndpoint="+ts.URL+"/devstoreaccount1;"),
+		s3fs.WithNamespace("container"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s3fs.Compressed(remote)
+	ctx := context.TODO()
+	content := strings.Repeat(`{"level":"info","msg":"hello"}`+"\n", 1000)
+	if err := c.Put(ctx, "logs.ndjson", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	encoding := encodings["/devstoreaccount1/container/logs.ndjson"]
+	mu.Unlock()
+	if encoding != s3fs.EncodingGzip {
+		t.Fatalf("put with Content-Encoding %q, want %q", encoding, s3fs.EncodingGzip)
+	}
+	for _, fsys := range []s3fs.FS{c, remote} {
+		b, err := fsys.ReadFileWithContext(ctx, "logs.ndjson")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fsys == remote {
+			r, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("read the blob as stored: %v", err)
+			}
+			b, _ = io.ReadAll(r)
+		}
+		if string(b) != content {
+			t.Fatalf("read %d bytes through %T, want %d bytes", len(b), fsys, len(content))
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package s3fs_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/longkai/s3fs"
+)
+
+// isolateAWSEnv clears the aws env, so the default chain only sees what the test sets.
+func isolateAWSEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if k, _, _ := strings.Cut(kv, "="); strings.HasPrefix(k, "AWS_") {
+			t.Setenv(k, "")
+			os.Unsetenv(k)
+		}
+	}
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+// authRecorder serves a fake s3 and records the Authorization and X-Amz-Security-Token headers.
+type authRecorder struct {
+	mu          sync.Mutex
+	auth, token string
+	server      *httptest.Server
+}
+
+func newAuthRecorder(t *testing.T) *authRecorder {
+	rec := &authRecorder{}
+	rec.server = newTestServer(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		rec.mu.Lock()
+		rec.auth, rec.token = r.Header.Get("Authorization"), r.Header.Get("X-Amz-Security-Token")
+		rec.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+	t.Cleanup(rec.server.Close)
+	return rec
+}
+
+func (rec *authRecorder) check(t *testing.T, options ...s3fs.Option) (ak, token string) {
+	t.Helper()
+	fs, err := s3fs.New(append([]s3fs.Option{
+		s3fs.WithNamespace("test-bucket"),
+		s3fs.WithOptFns(func(o *s3.Options) { o.BaseEndpoint = &rec.server.URL }),
+	}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Put(context.TODO(), "key", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	_, cred, _ := strings.Cut(rec.auth, "Credential=")
+	ak, _, _ = strings.Cut(cred, "/")
+	return ak, rec.token
+}
+
+func TestCredentials(t *testing.T) {
+	rec := newAuthRecorder(t)
+
+	t.Run("static", func(t *testing.T) {
+		isolateAWSEnv(t)
+		ak, token := rec.check(t, s3fs.WithCredential("STATICAK", "SK"), s3fs.WithSessionToken("TOKEN"))
+		if ak != "STATICAK" || token != "TOKEN" {
+			t.Fatalf("got ak %q token %q, want STATICAK TOKEN", ak, token)
+		}
+	})
+
+	t.Run("provider", func(t *testing.T) {
+		isolateAWSEnv(t)
+		provider := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "PROVIDERAK", SecretAccessKey: "SK"}, nil
+		})
+		ak, _ := rec.check(t, s3fs.WithCredential("STATICAK", "SK"), s3fs.WithCredentialsProvider(provider))
+		if ak != "PROVIDERAK" {
+			t.Fatalf("got ak %q, want PROVIDERAK", ak)
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		isolateAWSEnv(t)
+		t.Setenv("AWS_ACCESS_KEY_ID", "ENVAK")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "SK")
+		t.Setenv("AWS_SESSION_TOKEN", "ENVTOKEN")
+		ak, token := rec.check(t)
+		if ak != "ENVAK" || token != "ENVTOKEN" {
+			t.Fatalf("got ak %q token %q, want ENVAK ENVTOKEN", ak, token)
+		}
+	})
+
+	t.Run("shared credentials file", func(t *testing.T) {
+		isolateAWSEnv(t)
+		t.Setenv("AWS_PROFILE", "test")
+		content := "[test]\naws_access_key_id = FILEAK\naws_secret_access_key = SK\n"
+		if err := os.WriteFile(os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		ak, _ := rec.check(t)
+		if ak != "FILEAK" {
+			t.Fatalf("got ak %q, want FILEAK", ak)
+		}
+	})
+
+	t.Run("web identity", func(t *testing.T) {
+		isolateAWSEnv(t)
+		sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if r.Form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Form.Get("WebIdentityToken") != "jwt" {
+				http.Error(w, "unexpected request", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>WEBAK</AccessKeyId>
+      <SecretAccessKey>SK</SecretAccessKey>
+      <SessionToken>WEBTOKEN</SessionToken>
+      <Expiration>` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+		}))
+		defer sts.Close()
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		if err := os.WriteFile(tokenFile, []byte("jwt"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+		t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/test")
+		t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+		ak, token := rec.check(t)
+		if ak != "WEBAK" || token != "WEBTOKEN" {
+			t.Fatalf("got ak %q token %q, want WEBAK WEBTOKEN", ak, token)
+		}
+	})
+
+	t.Run("instance metadata", func(t *testing.T) {
+		isolateAWSEnv(t)
+		imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/latest/api/token":
+				w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+				w.Write([]byte("imds-token"))
+			case "/latest/meta-data/iam/security-credentials/":
+				w.Write([]byte("role"))
+			case "/latest/meta-data/iam/security-credentials/role":
+				json.NewEncoder(w).Encode(map[string]string{
+					"Code":            "Success",
+					"AccessKeyId":     "IMDSAK",
+					"SecretAccessKey": "SK",
+					"Token":           "IMDSTOKEN",
+					"Expiration":      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+				})
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer imds.Close()
+		t.Setenv("AWS_EC2_METADATA_DISABLED", "false")
+		t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+		ak, token := rec.check(t)
+		if ak != "IMDSAK" || token != "IMDSTOKEN" {
+			t.Fatalf("got ak %q token %q, want IMDSAK IMDSTOKEN", ak, token)
+		}
+	})
+}
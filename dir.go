@@ -2,35 +2,81 @@ package s3fs
 
 import (
 	"context"
+	"errors"
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
-var _ NamespacedFS = (*dirFs)(nil)
+var (
+	_ NamespacedFS     = (*dirFs)(nil)
+	_ ContextualStatFS = (*dirFs)(nil)
+	_ ContextualGlobFS = (*dirFs)(nil)
+	_ ListFS           = (*dirFs)(nil)
+	_ ListAfterFS      = (*dirFs)(nil)
+	_ ListDirFS        = (*dirFs)(nil)
+	_ RangeReadFS      = (*dirFs)(nil)
+	_ StatsFS          = (*dirFs)(nil)
+)
 
 type dirFs struct {
 	dir string
+	transfer
 }
 
-// DirFS returns a dir based fs.
-func DirFS(dir string) FS {
+// DirFS returns a dir based fs, options other than WithProgress are ignored.
+func DirFS(dir string, options ...Option) FS {
+	var a awsS3
+	for _, op := range options {
+		op(&a)
+	}
 	return &dirFs{
-		dir: dir,
+		dir:      dir,
+		transfer: transfer{progress: a.progress, counters: new(counters)},
 	}
 }
 
+// root opens the dir for the op of the name, which must be valid by fs.ValidPath, e.g., no "..", "./x" or
+// leading slash, and returns the name in the local separator. The name is resolved under the root only,
+// so symlinks escaping the dir fail as well.
+func (d *dirFs) root(op, name string) (*os.Root, string, error) {
+	if !fs.ValidPath(name) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	root, err := os.OpenRoot(d.dir)
+	if err != nil {
+		return nil, "", err
+	}
+	return root, filepath.FromSlash(name), nil
+}
+
 // Delete implements NamespacedFS.
 func (d *dirFs) Delete(ctx context.Context, name string) error {
-	fname := filepath.Join(d.dir, name)
-	return os.Remove(fname)
+	root, local, err := d.root("delete", name)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	return root.Remove(local)
+}
+
+// location identifies the dir by its absolute path.
+func (d *dirFs) location() string {
+	if abs, err := filepath.Abs(d.dir); err == nil {
+		return abs
+	}
+	return d.dir
 }
 
 // Namespace implements NamespacedFS.
 func (d *dirFs) Namespace(dir string) FS {
 	return &dirFs{
-		dir: dir,
+		dir:      dir,
+		transfer: d.transfer,
 	}
 }
 
@@ -41,27 +87,266 @@ func (d *dirFs) Open(name string) (fs.File, error) {
 
 // OpenWithContext implements NamespacedFS.
 func (d *dirFs) OpenWithContext(ctx context.Context, name string) (fs.File, error) {
-	return os.Open(filepath.Join(d.dir, name))
+	root, local, err := d.root("open", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	t := d.track(OpRead, name, -1)
+	f, err := root.Open(local)
+	if err != nil || t == nil {
+		return f, err
+	}
+	if info, err := f.Stat(); err == nil {
+		t.setTotal(info.Size())
+	}
+	return &dirFile{File: f, r: t.reader(f)}, nil
+}
+
+// dirFile counts the bytes read of the file.
+type dirFile struct {
+	*os.File
+	r io.Reader
 }
 
+// Read implements fs.File.
+func (f *dirFile) Read(b []byte) (int, error) { return f.r.Read(b) }
+
 // Put implements NamespacedFS.
 func (d *dirFs) Put(ctx context.Context, name string, reader io.Reader) error {
-	fname := filepath.Join(d.dir, name)
-	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	root, local, err := d.root("put", name)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	if err := mkdirAll(root, path.Dir(name)); err != nil {
 		return err
 	}
-	f, err := os.Create(fname)
+	f, err := root.Create(local)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	_, err = io.Copy(f, reader)
+	_, err = io.Copy(f, d.track(OpPut, name, readerSize(reader)).reader(reader))
 	return err
 }
 
+// mkdirAll creates the slash separated dir under the root along with its parents.
+func mkdirAll(root *os.Root, dir string) error {
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	if err := mkdirAll(root, path.Dir(dir)); err != nil {
+		return err
+	}
+	if err := root.Mkdir(filepath.FromSlash(dir), 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// Stat implements ContextualStatFS.
+func (d *dirFs) Stat(name string) (fs.FileInfo, error) {
+	root, local, err := d.root("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.Stat(local)
+}
+
+// StatWithContext implements ContextualStatFS.
+func (d *dirFs) StatWithContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	return d.Stat(name)
+}
+
+// ReadRange implements RangeReadFS.
+func (d *dirFs) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	root, local, err := d.root("open", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	f, err := root.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	var r io.Reader = f
+	if length >= 0 {
+		r = io.LimitReader(f, length)
+	}
+	return d.track(OpRead, name, length).readCloser(struct {
+		io.Reader
+		io.Closer
+	}{r, f}), nil
+}
+
+// List implements ListFS, names are slash separated paths relative to the dir.
+func (d *dirFs) List(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error {
+	// walk the deepest dir covering the prefix only
+	dir := path.Dir(prefix + "x")
+	root, _, err := d.root("list", dir)
+	if errors.Is(err, fs.ErrInvalid) || errors.Is(err, fs.ErrNotExist) {
+		return nil // nothing under a dir escaping or missing
+	}
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	fsys := root.FS()
+	if _, err := fs.Stat(fsys, dir); errors.Is(err, fs.ErrNotExist) {
+		return nil // nothing under the prefix
+	}
+	return fs.WalkDir(fsys, dir, func(name string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			return ctx.Err()
+		}
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		return fn(&objectInfo{name: name, size: info.Size(), modTime: info.ModTime()})
+	})
+}
+
+// ListAfter implements ListAfterFS, which walks the dirs in the lexical order of the names, i.e., as if dirs had
+// a trailing slash, skipping the ones of names before after.
+func (d *dirFs) ListAfter(ctx context.Context, prefix, after string, fn func(fs.FileInfo) error) error {
+	dir := path.Dir(prefix + "x")
+	root, _, err := d.root("list", dir)
+	if errors.Is(err, fs.ErrInvalid) || errors.Is(err, fs.ErrNotExist) {
+		return nil // nothing under a dir escaping or missing
+	}
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	return walkAfter(ctx, root.FS(), dir, prefix, after, fn)
+}
+
+// walkAfter calls fn for the files under the dir with the prefix and after the name, in lexical order.
+func walkAfter(ctx context.Context, fsys fs.FS, dir, prefix, after string, fn func(fs.FileInfo) error) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	key := func(e fs.DirEntry) string {
+		name := path.Join(dir, e.Name())
+		if e.IsDir() {
+			name += "/"
+		}
+		return name
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(key(a), key(b)) })
+	for _, e := range entries {
+		name := key(e)
+		if e.IsDir() {
+			inPrefix := strings.HasPrefix(name, prefix) || strings.HasPrefix(prefix, name)
+			if inPrefix && (name > after || strings.HasPrefix(after, name)) {
+				if err := walkAfter(ctx, fsys, strings.TrimSuffix(name, "/"), prefix, after, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if name <= after || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		if err := fn(&objectInfo{name: name, size: info.Size(), modTime: info.ModTime()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListDir implements ListDirFS.
+func (d *dirFs) ListDir(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error {
+	dir := path.Dir(prefix + "x")
+	root, _, err := d.root("list", dir)
+	if errors.Is(err, fs.ErrInvalid) || errors.Is(err, fs.ErrNotExist) {
+		return nil // nothing under a dir escaping or missing
+	}
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	entries, err := fs.ReadDir(root.FS(), dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		var info fs.FileInfo = &dirInfo{name}
+		if !e.IsDir() {
+			fi, err := e.Info()
+			if err != nil {
+				return err
+			}
+			info = &objectInfo{name: name, size: fi.Size(), modTime: fi.ModTime()}
+		}
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// Glob implements ContextualGlobFS.
+func (d *dirFs) Glob(pattern string) ([]string, error) {
+	return d.GlobWithContext(context.Background(), pattern)
+}
+
+// GlobWithContext implements ContextualGlobFS.
+func (d *dirFs) GlobWithContext(ctx context.Context, pattern string) ([]string, error) {
+	return glob(ctx, d, pattern)
+}
+
 // ReadFile implements NamespacedFS.
 func (d *dirFs) ReadFile(name string) ([]byte, error) {
-	return os.ReadFile(filepath.Join(d.dir, name))
+	root, local, err := d.root("open", name)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	t := d.track(OpRead, name, -1)
+	f, err := root.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err == nil {
+		t.setTotal(int64(len(b)))
+		t.add(int64(len(b)), 0)
+	}
+	return b, err
 }
 
 // ReadFileWithContext implements NamespacedFS.
@@ -0,0 +1,56 @@
+package s3fs_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestDirFSNames(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "dir")
+	if err := os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	local := s3fs.DirFS(dir)
+	ctx := context.TODO()
+	if err := local.Put(ctx, "sub/x", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(parent, "secret"), filepath.Join(dir, "link")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+
+	b, err := local.ReadFile("sub/x")
+	if err != nil || string(b) != "x" {
+		t.Fatalf("ReadFile = %q, %v", b, err)
+	}
+	// every method rejects the same names
+	for _, name := range []string{"../secret", "./sub/x", "/sub/x", "sub/../sub/x", "link"} {
+		errs := map[string]error{}
+		_, errs["Open"] = local.Open(name)
+		_, errs["ReadFile"] = local.ReadFile(name)
+		_, errs["Stat"] = local.(s3fs.ContextualStatFS).Stat(name)
+		_, errs["ReadRange"] = local.(s3fs.RangeReadFS).ReadRange(ctx, name, 0, -1)
+		errs["Put"] = local.Put(ctx, name, strings.NewReader("overwritten"))
+		if name != "link" { // removes the link only
+			errs["Delete"] = local.Delete(ctx, name)
+		}
+		for method, err := range errs {
+			if err == nil {
+				t.Errorf("%s(%q) should fail", method, name)
+			} else if name != "link" && !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("%s(%q) = %v, want %v", method, name, err, fs.ErrInvalid)
+			}
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(parent, "secret")); err != nil || string(b) != "secret" {
+		t.Fatalf("file outside the dir = %q, %v", b, err)
+	}
+}
@@ -0,0 +1,546 @@
+package s3fs
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+var (
+	_ ContextualStatFS = (*encryptedFs)(nil)
+	_ RangeReadFS      = (*encryptedFs)(nil)
+	_ ListFS           = (*encryptedFs)(nil)
+	_ MetadataFS       = (*encryptedFs)(nil)
+)
+
+// KeyProvider protects the data keys of Encrypted by a key encryption key, e.g., of a KMS.
+type KeyProvider interface {
+	// WrapKey encrypts the data key of a file.
+	WrapKey(ctx context.Context, key []byte) ([]byte, error)
+
+	// UnwrapKey decrypts the data key wrapped by WrapKey.
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// AESKeyProvider wraps data keys by AES-GCM with the 128, 192 or 256-bit key encryption key.
+func AESKeyProvider(kek []byte) (KeyProvider, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aesKeyProvider{aead}, nil
+}
+
+type aesKeyProvider struct {
+	aead cipher.AEAD
+}
+
+// WrapKey implements KeyProvider, the wrapped key is the random nonce followed by the sealed key.
+func (p aesKeyProvider) WrapKey(ctx context.Context, key []byte) ([]byte, error) {
+	nonce := make([]byte, p.aead.NonceSize(), p.aead.NonceSize()+len(key)+p.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return p.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// UnwrapKey implements KeyProvider.
+func (p aesKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < p.aead.NonceSize() {
+		return nil, errors.New("s3fs: malformed wrapped key")
+	}
+	n := p.aead.NonceSize()
+	return p.aead.Open(nil, wrapped[:n], wrapped[n:], nil)
+}
+
+const (
+	// encryptedKeyMeta is the user metadata of the wrapped data key of encrypted files.
+	encryptedKeyMeta = "s3fs_encrypted_key"
+	// segmentSize is the plaintext size of each segment sealed by AES-GCM, except the last one.
+	segmentSize = 64 << 10
+	// sealedSegmentSize is the ciphertext size of a full segment, i.e., followed by the tag.
+	sealedSegmentSize = segmentSize + 16
+)
+
+// errNotEncrypted is returned reading a file without the wrapped data key.
+var errNotEncrypted = errors.New("s3fs: file is not encrypted")
+
+// Encrypted wraps the fs to encrypt files on the client side, so that only ciphertext leaves the process.
+//
+// Each file is encrypted by a random AES-256 data key in AES-GCM segments of 64KiB, so that seeking and
+// ranged reads decrypt the segments covered only. The data key is wrapped by the key provider and stored
+// in the metadata of the file, thus the fs must be a MetadataFS and a ContextualStatFS, e.g., aws s3 or azure blob.
+// Sizes reported by Stat and List are of the plaintext, List stats the files listed without metadata, e.g., by
+// aws s3, to tell the encrypted ones from the plain ones.
+func Encrypted(fsys FS, keys KeyProvider) FS {
+	return &encryptedFs{fsys: fsys, keys: keys}
+}
+
+type encryptedFs struct {
+	fsys FS
+	keys KeyProvider
+}
+
+// plainSize returns the plaintext size of the ciphertext size, which is sealed by the segments
+// of segmentSize but the last one, which is possibly empty.
+func plainSize(size int64) int64 {
+	segments := max(1, (size+sealedSegmentSize-1)/sealedSegmentSize)
+	return max(0, size-segments*(sealedSegmentSize-segmentSize))
+}
+
+// segmentNonce returns the nonce of the segment, which is its index flagged if last, so that reordered
+// or truncated segments fail to open.
+func segmentNonce(nonce []byte, index int64, last bool) []byte {
+	clear(nonce)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func newSegmentCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Put implements FS.
+func (e *encryptedFs) Put(ctx context.Context, name string, reader io.Reader) error {
+	return e.PutWithMetadata(ctx, name, reader, Metadata{})
+}
+
+// PutWithMetadata implements MetadataFS, the metadata is stored in plaintext.
+func (e *encryptedFs) PutWithMetadata(ctx context.Context, name string, reader io.Reader, metadata Metadata) error {
+	m, ok := e.fsys.(MetadataFS)
+	if !ok {
+		return fmt.Errorf("s3fs: encrypted fs without metadata: %w", errors.ErrUnsupported)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	wrapped, err := e.keys.WrapKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	aead, err := newSegmentCipher(key)
+	if err != nil {
+		return err
+	}
+	user := make(map[string]string, len(metadata.User)+1)
+	for k, v := range metadata.User {
+		user[k] = v
+	}
+	user[encryptedKeyMeta] = base64.StdEncoding.EncodeToString(wrapped)
+	metadata.User = user
+	return m.PutWithMetadata(ctx, name, &encryptReader{r: reader, aead: aead}, metadata)
+}
+
+// Delete implements FS.
+func (e *encryptedFs) Delete(ctx context.Context, name string) error {
+	return e.fsys.Delete(ctx, name)
+}
+
+// Stat implements ContextualStatFS.
+func (e *encryptedFs) Stat(name string) (fs.FileInfo, error) {
+	return e.StatWithContext(context.Background(), name)
+}
+
+// StatWithContext implements ContextualStatFS.
+func (e *encryptedFs) StatWithContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	info, _, err := e.stat(ctx, name)
+	return info, err
+}
+
+// stat returns the plaintext info of the file and its data key.
+func (e *encryptedFs) stat(ctx context.Context, name string) (*encryptedInfo, []byte, error) {
+	s, ok := e.fsys.(ContextualStatFS)
+	if !ok {
+		return nil, nil, fmt.Errorf("s3fs: encrypted fs without stat: %w", errors.ErrUnsupported)
+	}
+	info, err := s.StatWithContext(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var wrapped string
+	if m, ok := info.(MetadataInfo); ok {
+		wrapped = m.Metadata().User[encryptedKeyMeta]
+	}
+	b, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || wrapped == "" {
+		return nil, nil, &fs.PathError{Op: "decrypt", Path: name, Err: errNotEncrypted}
+	}
+	key, err := e.keys.UnwrapKey(ctx, b)
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: "decrypt", Path: name, Err: err}
+	}
+	return &encryptedInfo{FileInfo: info}, key, nil
+}
+
+// List implements ListFS.
+func (e *encryptedFs) List(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error {
+	l, ok := e.fsys.(ListFS)
+	if !ok {
+		return fmt.Errorf("s3fs: encrypted fs without list: %w", errors.ErrUnsupported)
+	}
+	return l.List(ctx, prefix, func(info fs.FileInfo) error {
+		info, err := e.listed(ctx, info)
+		if err != nil {
+			return err
+		}
+		return fn(info)
+	})
+}
+
+// listed returns the plaintext info of the listed file if it's encrypted, otherwise the info as is. Files
+// listed without user metadata, e.g., by aws s3, are stated for the wrapped data key.
+func (e *encryptedFs) listed(ctx context.Context, info fs.FileInfo) (fs.FileInfo, error) {
+	m, ok := info.(MetadataInfo)
+	if !ok || m.Metadata().User == nil {
+		s, ok := e.fsys.(ContextualStatFS)
+		if !ok {
+			return info, nil
+		}
+		stated, err := s.StatWithContext(ctx, info.Name())
+		if errors.Is(err, fs.ErrNotExist) {
+			return info, nil // deleted since listed
+		} else if err != nil {
+			return nil, err
+		}
+		if m, ok = stated.(MetadataInfo); !ok {
+			return info, nil
+		}
+		info = stated
+	}
+	if m.Metadata().User[encryptedKeyMeta] == "" {
+		return info, nil
+	}
+	return &encryptedInfo{FileInfo: info}, nil
+}
+
+// ReadRange implements RangeReadFS.
+func (e *encryptedFs) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	info, key, err := e.stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return e.readRange(ctx, info, key, offset, length)
+}
+
+// readRange decrypts the segments covering length bytes from offset, or up to the end if length is negative.
+func (e *encryptedFs) readRange(ctx context.Context, info *encryptedInfo, key []byte, offset, length int64) (io.ReadCloser, error) {
+	size := info.Size()
+	if length < 0 || offset+length > size {
+		length = max(0, size-offset)
+	}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	aead, err := newSegmentCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	first, last := offset/segmentSize, (offset+length-1)/segmentSize
+	start := first * sealedSegmentSize
+	end := min(info.FileInfo.Size(), (last+1)*sealedSegmentSize)
+	rc, err := e.readCipher(ctx, info, start, end-start)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		rc:    rc,
+		aead:  aead,
+		name:  info.Name(),
+		index: first,
+		last:  (info.FileInfo.Size() - 1) / sealedSegmentSize,
+		skip:  offset - first*segmentSize,
+		left:  length,
+	}, nil
+}
+
+// readCipher reads length bytes of the ciphertext from offset. The whole file streams through the file opened,
+// e.g., the object reader of the built-in backends fetching it chunk by chunk, while parts of it are ranged reads
+// if possible, as seeking the object reader forward downloads the rest at once.
+func (e *encryptedFs) readCipher(ctx context.Context, info *encryptedInfo, offset, length int64) (io.ReadCloser, error) {
+	name := info.Name()
+	if rr, ok := e.fsys.(RangeReadFS); ok && (offset > 0 || length < info.FileInfo.Size()) {
+		return rr.ReadRange(ctx, name, offset, length)
+	}
+	f, err := e.fsys.OpenWithContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := f.(io.Seeker); ok {
+		_, err = s.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, f, offset)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+// Open implements FS.
+func (e *encryptedFs) Open(name string) (fs.File, error) {
+	return e.OpenWithContext(context.Background(), name)
+}
+
+// OpenWithContext implements FS, the file decrypts from where it's read lazily, seeking by ranged reads.
+func (e *encryptedFs) OpenWithContext(ctx context.Context, name string) (fs.File, error) {
+	info, key, err := e.stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedFile{ctx: ctx, fsys: e, info: info, key: key}, nil
+}
+
+// ReadFile implements FS.
+func (e *encryptedFs) ReadFile(name string) ([]byte, error) {
+	return e.ReadFileWithContext(context.Background(), name)
+}
+
+// ReadFileWithContext implements FS.
+func (e *encryptedFs) ReadFileWithContext(ctx context.Context, name string) ([]byte, error) {
+	rc, err := e.ReadRange(ctx, name, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// encryptedInfo reports the plaintext size of an encrypted file.
+type encryptedInfo struct {
+	fs.FileInfo
+}
+
+// Size implements fs.FileInfo.
+func (i *encryptedInfo) Size() int64 { return plainSize(i.FileInfo.Size()) }
+
+// ETag implements ETagger.
+func (i *encryptedInfo) ETag() string {
+	if e, ok := i.FileInfo.(ETagger); ok {
+		return e.ETag()
+	}
+	return ""
+}
+
+// Metadata implements MetadataInfo, without the wrapped data key.
+func (i *encryptedInfo) Metadata() Metadata {
+	m, ok := i.FileInfo.(MetadataInfo)
+	if !ok {
+		return Metadata{}
+	}
+	md := m.Metadata()
+	user := make(map[string]string, len(md.User))
+	for k, v := range md.User {
+		if k != encryptedKeyMeta {
+			user[k] = v
+		}
+	}
+	md.User = user
+	return md
+}
+
+// encryptedFile is an encrypted file being read, which implements fs.File and io.Seeker.
+type encryptedFile struct {
+	ctx    context.Context
+	fsys   *encryptedFs
+	info   *encryptedInfo
+	key    []byte
+	offset int64
+	rc     io.ReadCloser // from offset to the end, opened lazily
+	closed bool
+}
+
+// Read implements fs.File.
+func (f *encryptedFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.info.Name(), Err: fs.ErrClosed}
+	}
+	if f.rc == nil {
+		rc, err := f.fsys.readRange(f.ctx, f.info, f.key, f.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		f.rc = rc
+	}
+	n, err := f.rc.Read(b)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker, the next Read starts from the segment of the offset.
+func (f *encryptedFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.Name(), Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, errors.New("s3fs: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("s3fs: negative position")
+	}
+	if offset != f.offset && f.rc != nil {
+		f.rc.Close()
+		f.rc = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Stat implements fs.File.
+func (f *encryptedFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Close implements fs.File.
+func (f *encryptedFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.rc != nil {
+		return f.rc.Close()
+	}
+	return nil
+}
+
+// encryptReader seals the plaintext segment by segment, reading one segment ahead to flag the last one.
+type encryptReader struct {
+	r         io.Reader
+	aead      cipher.AEAD
+	index     int64
+	cur, next []byte
+	nonce     []byte
+	out       []byte // sealed but not read yet
+	started   bool
+	done      bool
+}
+
+// Read implements io.Reader.
+func (r *encryptReader) Read(b []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *encryptReader) seal() error {
+	if !r.started {
+		r.started = true
+		r.nonce = make([]byte, r.aead.NonceSize())
+		r.cur, r.next = make([]byte, segmentSize), make([]byte, segmentSize)
+		n, err := readSegment(r.r, r.cur)
+		if err != nil {
+			return err
+		}
+		r.cur = r.cur[:n]
+	}
+	n, err := readSegment(r.r, r.next[:segmentSize])
+	if err != nil {
+		return err
+	}
+	r.next = r.next[:n]
+	last := n == 0
+	r.out = r.aead.Seal(r.out[:0], segmentNonce(r.nonce, r.index, last), r.cur, nil)
+	r.index++
+	r.cur, r.next = r.next, r.cur[:cap(r.cur)]
+	r.done = last
+	return nil
+}
+
+// readSegment reads a full segment, or less at the end.
+func readSegment(r io.Reader, b []byte) (int, error) {
+	n, err := io.ReadFull(r, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// decryptReader opens the sealed segments one by one, skipping and limiting the plaintext to the range.
+type decryptReader struct {
+	rc    io.ReadCloser
+	aead  cipher.AEAD
+	name  string
+	index int64 // of the next segment
+	last  int64 // index of the last segment of the file
+	skip  int64 // plaintext to skip in the first segment
+	left  int64 // plaintext left to read
+	buf   []byte
+	nonce []byte
+	plain []byte // opened but not read yet
+}
+
+// Read implements io.Reader.
+func (r *decryptReader) Read(b []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+	for len(r.plain) == 0 {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, r.plain[:min(int64(len(r.plain)), r.left)])
+	r.plain = r.plain[n:]
+	r.left -= int64(n)
+	return n, nil
+}
+
+func (r *decryptReader) open() error {
+	if r.buf == nil {
+		r.buf = make([]byte, sealedSegmentSize)
+		r.nonce = make([]byte, r.aead.NonceSize())
+	}
+	n, err := io.ReadFull(r.rc, r.buf)
+	if err == io.ErrUnexpectedEOF && r.index == r.last || err == nil {
+		var plain []byte
+		plain, err = r.aead.Open(r.buf[:0], segmentNonce(r.nonce, r.index, r.index == r.last), r.buf[:n], nil)
+		if err == nil {
+			r.plain = plain[r.skip:]
+			r.skip = 0
+			r.index++
+			return nil
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &fs.PathError{Op: "decrypt", Path: r.name, Err: err}
+}
+
+// Close implements io.Closer.
+func (r *decryptReader) Close() error { return r.rc.Close() }
@@ -0,0 +1,130 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestEncrypted(t *testing.T) {
+	remote, done := newTestFs(withOptions(s3fs.WithBufferSize(32 << 10)))
+	defer done()
+	keys, err := s3fs.AESKeyProvider(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := s3fs.Encrypted(remote, keys)
+	ctx := context.TODO()
+
+	const segment = 64 << 10
+	for _, size := range []int{0, 10, segment, 2*segment + 5} {
+		content := make([]byte, size)
+		for i := range content {
+			content[i] = byte(rand.IntN(256))
+		}
+		if err := enc.Put(ctx, "file", bytes.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := remote.ReadFileWithContext(ctx, "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(raw) <= size || size > 0 && bytes.Contains(raw, content) {
+			t.Fatalf("size %d: stored %d bytes, want ciphertext", size, len(raw))
+		}
+		b, err := enc.ReadFileWithContext(ctx, "file")
+		if err != nil || !bytes.Equal(b, content) {
+			t.Fatalf("size %d: read %d bytes, %v, want the plaintext", size, len(b), err)
+		}
+		info, err := enc.(s3fs.ContextualStatFS).StatWithContext(ctx, "file")
+		if err != nil || info.Size() != int64(size) {
+			t.Fatalf("size %d: stat %v, %v", size, info, err)
+		}
+		if size < segment {
+			continue
+		}
+
+		// ranged reads across segments
+		for _, r := range [][2]int64{{0, 1}, {segment - 3, 6}, {segment, 5}, {int64(size) - 7, -1}, {10, int64(size)}} {
+			rc, err := enc.(s3fs.RangeReadFS).ReadRange(ctx, "file", r[0], r[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(rc)
+			rc.Close()
+			want := content[r[0]:]
+			if r[1] >= 0 {
+				want = want[:min(int64(len(want)), r[1])]
+			}
+			if err != nil || !bytes.Equal(b, want) {
+				t.Fatalf("size %d: read range %v got %d bytes, %v, want %d bytes", size, r, len(b), err, len(want))
+			}
+		}
+
+		// seek
+		f, err := enc.OpenWithContext(ctx, "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.(io.Seeker).Seek(-5, io.SeekEnd); err != nil {
+			t.Fatal(err)
+		}
+		b, err = io.ReadAll(f)
+		f.Close()
+		if err != nil || !bytes.Equal(b, content[size-5:]) {
+			t.Fatalf("size %d: read %x after seek, %v, want %x", size, b, err, content[size-5:])
+		}
+	}
+
+	// truncated
+	info, err := remote.(s3fs.ContextualStatFS).StatWithContext(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := remote.ReadFileWithContext(ctx, "file")
+	if err := remote.(s3fs.MetadataFS).PutWithMetadata(ctx, "file", bytes.NewReader(raw[:segment+16]), info.(s3fs.MetadataInfo).Metadata()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enc.ReadFileWithContext(ctx, "file"); err == nil {
+		t.Fatal("read truncated file should fail")
+	}
+
+	// wrong key
+	other, _ := s3fs.AESKeyProvider(bytes.Repeat([]byte{2}, 32))
+	if err := enc.Put(ctx, "file", strings.NewReader("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s3fs.Encrypted(remote, other).ReadFileWithContext(ctx, "file"); err == nil {
+		t.Fatal("read by another key should fail")
+	}
+
+	// not encrypted
+	if err := remote.Put(ctx, "plain", strings.NewReader("plain")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enc.OpenWithContext(ctx, "plain"); err == nil {
+		t.Fatal("open plain file should fail")
+	}
+	if _, err := enc.OpenWithContext(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("open missing file got %v, want fs.ErrNotExist", err)
+	}
+
+	// listed by the plaintext sizes of the encrypted files only
+	sizes := make(map[string]int64)
+	if err := enc.(s3fs.ListFS).List(ctx, "", func(info fs.FileInfo) error {
+		sizes[info.Name()] = info.Size()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sizes["file"] != int64(len("secret")) || sizes["plain"] != int64(len("plain")) {
+		t.Fatalf("listed sizes %v, want the plaintext ones", sizes)
+	}
+}
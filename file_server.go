@@ -0,0 +1,276 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// FileServerOption configures the handler returned by FileServer.
+type FileServerOption func(s *fileServer)
+
+// WithPresignRedirect redirects GET requests of files no smaller than minSize to presigned urls which expire
+// after the given duration, so that clients download large files from the storage service directly.
+// It requires the fs to implement PresignFS, files are served as usual if presigning fails.
+func WithPresignRedirect(minSize int64, expires time.Duration) FileServerOption {
+	return func(s *fileServer) {
+		s.redirectSize = minSize
+		s.redirectExpires = expires
+	}
+}
+
+// WithErrorHandler replies the errors of the fs, e.g., fs.ErrNotExist, by fn rather than plain text responses.
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) FileServerOption {
+	return func(s *fileServer) {
+		s.serveError = fn
+	}
+}
+
+// FileServer returns a handler that serves GET and HEAD requests with the files of the fs, where the url path is
+// the file name. Like http.FileServer, it handles conditional requests by the ETag and Last-Modified of files,
+// and range requests by ranged reads of the fs, if it implements RangeReadFS, rather than full downloads.
+// Dirs are not listed.
+func FileServer(fsys FS, options ...FileServerOption) http.Handler {
+	s := &fileServer{fsys: fsys, redirectSize: -1, serveError: serveError}
+	for _, op := range options {
+		op(s)
+	}
+	return s
+}
+
+type fileServer struct {
+	fsys FS
+
+	redirectSize    int64 // negative means never
+	redirectExpires time.Duration
+
+	serveError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)[1:] // no way out of the dir of DirFS
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		s.serveError(w, r, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist})
+		return
+	}
+
+	ctx := r.Context()
+	info, f, err := s.stat(ctx, name)
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	if f != nil {
+		defer f.Close()
+	}
+
+	if s.redirectSize >= 0 && info.Size() >= s.redirectSize && r.Method == http.MethodGet {
+		if p, ok := s.fsys.(PresignFS); ok {
+			u, err := p.PresignGet(ctx, name, func(o *s3.PresignOptions) {
+				o.Expires = s.redirectExpires
+			})
+			if err == nil {
+				http.Redirect(w, r, u, http.StatusTemporaryRedirect)
+				return
+			}
+		}
+	}
+
+	h := w.Header()
+	ctype := contentType(info)
+	if ctype == "" {
+		ctype = mime.TypeByExtension(path.Ext(name))
+	}
+	if ctype == "" {
+		ctype = "application/octet-stream" // never sniff, which reads the content
+	}
+	h.Set("Content-Type", ctype)
+	h.Set("ETag", httpETag(info))
+
+	var content io.ReadSeeker
+	if rr, ok := s.fsys.(RangeReadFS); ok && f == nil {
+		rs := &rangeSeeker{ctx: ctx, fsys: rr, name: name, size: info.Size(), ends: rangeEnds(r.Header.Get("Range"), info.Size())}
+		defer rs.Close()
+		content = rs
+	} else {
+		if f == nil {
+			if f, err = s.fsys.OpenWithContext(ctx, name); err != nil {
+				s.serveError(w, r, err)
+				return
+			}
+			defer f.Close()
+		}
+		if content, ok = f.(io.ReadSeeker); !ok {
+			s.serveError(w, r, fmt.Errorf("s3fs: %T can't seek", f))
+			return
+		}
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// contentType returns the content type stored with the file, but not the generic one defaulted by buckets.
+func contentType(info fs.FileInfo) string {
+	m, ok := info.(MetadataInfo)
+	if !ok {
+		return ""
+	}
+	switch ctype := m.Metadata().ContentType; ctype {
+	case "binary/octet-stream", "application/octet-stream":
+		return ""
+	default:
+		return ctype
+	}
+}
+
+// stat gets the file info, by opening the file if the fs can't stat, in which case the opened file is returned.
+func (s *fileServer) stat(ctx context.Context, name string) (fs.FileInfo, fs.File, error) {
+	if sfs, ok := s.fsys.(ContextualStatFS); ok {
+		info, err := sfs.StatWithContext(ctx, name)
+		return info, nil, err
+	}
+	f, err := s.fsys.OpenWithContext(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return info, f, nil
+}
+
+func serveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// httpETag returns the quoted ETag of the file, or one made of its size and modification time like nginx,
+// which is strong so that If-Range and If-Match work.
+func httpETag(info fs.FileInfo) string {
+	if e, ok := info.(ETagger); ok && e.ETag() != "" {
+		if tag := e.ETag(); strings.HasPrefix(tag, `"`) || strings.HasPrefix(tag, `W/"`) {
+			return tag
+		}
+		return strconv.Quote(e.ETag())
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+// rangeEnds parses the Range header, and maps the first byte of each bounded range to its last one.
+// It's a hint of how many bytes to read, http.ServeContent does the rest.
+func rangeEnds(header string, size int64) map[int64]int64 {
+	specs, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil
+	}
+	ends := make(map[int64]int64)
+	for spec := range strings.SplitSeq(specs, ",") {
+		first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+		if !ok || first == "" || last == "" {
+			continue
+		}
+		start, err1 := strconv.ParseInt(first, 10, 64)
+		end, err2 := strconv.ParseInt(last, 10, 64)
+		if err1 != nil || err2 != nil || start > end || start >= size {
+			continue
+		}
+		ends[start] = max(ends[start], min(end, size-1))
+	}
+	return ends
+}
+
+// rangeSeeker is an io.ReadSeeker of a file, which reads lazily from the offset seeked to by ranged reads.
+type rangeSeeker struct {
+	ctx  context.Context
+	fsys RangeReadFS
+	name string
+	size int64
+	ends map[int64]int64 // hints of the last byte to read from an offset, or up to the end of the file
+
+	offset int64
+	r      io.ReadCloser
+}
+
+// Seek implements io.Seeker, it never reads.
+func (rs *rangeSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += rs.offset
+	case io.SeekEnd:
+		offset += rs.size
+	}
+	if offset < 0 {
+		return 0, errors.New("s3fs: seek before the start of file")
+	}
+	if offset != rs.offset {
+		rs.Close()
+		rs.offset = offset
+	}
+	return offset, nil
+}
+
+// Read implements io.Reader.
+func (rs *rangeSeeker) Read(p []byte) (int, error) {
+	for {
+		if rs.offset >= rs.size {
+			return 0, io.EOF
+		}
+		fresh := rs.r == nil
+		if fresh {
+			end, ok := rs.ends[rs.offset]
+			if !ok {
+				end = rs.size - 1
+			}
+			r, err := rs.fsys.ReadRange(rs.ctx, rs.name, rs.offset, end-rs.offset+1)
+			if err != nil {
+				return 0, err
+			}
+			rs.r = r
+		}
+		n, err := rs.r.Read(p)
+		rs.offset += int64(n)
+		if err == io.EOF {
+			rs.Close() // read beyond the hint, continue with another range
+			if n == 0 && fresh {
+				return 0, io.ErrUnexpectedEOF
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close closes the ongoing ranged read if any.
+func (rs *rangeSeeker) Close() error {
+	if rs.r == nil {
+		return nil
+	}
+	err := rs.r.Close()
+	rs.r = nil
+	return err
+}
@@ -0,0 +1,175 @@
+package s3fs_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/longkai/s3fs"
+)
+
+// rangeRecorder serves a fake s3 and records the Range headers of GET requests.
+type rangeRecorder struct {
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newRangeRecorder(t *testing.T) (*rangeRecorder, s3fs.FS) {
+	rec := &rangeRecorder{}
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Method == http.MethodGet {
+			rec.mu.Lock()
+			rec.ranges = append(rec.ranges, r.Header.Get("Range"))
+			rec.mu.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	}), withOptions(s3fs.WithBufferSize(0)))
+	t.Cleanup(done)
+	return rec, fs
+}
+
+func (rec *rangeRecorder) take() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	ranges := rec.ranges
+	rec.ranges = nil
+	return ranges
+}
+
+func TestFileServer(t *testing.T) {
+	rec, remote := newRangeRecorder(t)
+	content := "hello world, from the file server"
+	if err := remote.Put(context.TODO(), "dir/hello.txt", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s3fs.FileServer(remote))
+	defer ts.Close()
+
+	get := func(path string, header http.Header, wantStatus int, wantBody string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		b, _ := io.ReadAll(rsp.Body)
+		if rsp.StatusCode != wantStatus || wantBody != "" && string(b) != wantBody {
+			t.Fatalf("GET %s %v = %d %q, want %d %q", path, header, rsp.StatusCode, b, wantStatus, wantBody)
+		}
+		return rsp
+	}
+
+	rsp := get("/dir/hello.txt", nil, http.StatusOK, content)
+	etag := rsp.Header.Get("ETag")
+	if ct := rsp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("Content-Type = %q, want text/plain", ct)
+	}
+	if etag == "" || rsp.Header.Get("Last-Modified") == "" {
+		t.Fatalf("missing validators: %v", rsp.Header)
+	}
+	rec.take()
+
+	get("/dir/hello.txt", http.Header{"If-None-Match": {etag}}, http.StatusNotModified, "")
+	if ranges := rec.take(); len(ranges) != 0 {
+		t.Fatalf("conditional GET downloaded the file: %q", ranges)
+	}
+
+	get("/dir/hello.txt", http.Header{"Range": {"bytes=6-10"}}, http.StatusPartialContent, "world")
+	if ranges := rec.take(); len(ranges) != 1 || ranges[0] != "bytes=6-10" {
+		t.Fatalf("backend ranges = %q, want [bytes=6-10]", ranges)
+	}
+	get("/dir/hello.txt", http.Header{"Range": {"bytes=-6"}}, http.StatusPartialContent, "server")
+	get("/dir/hello.txt", http.Header{"Range": {"bytes=0-4"}, "If-Range": {`"stale"`}}, http.StatusOK, content)
+	get("/dir/hello.txt", http.Header{"Range": {"bytes=100-"}}, http.StatusRequestedRangeNotSatisfiable, "")
+
+	get("/dir/missing.txt", nil, http.StatusNotFound, "")
+	get("/dir/", nil, http.StatusNotFound, "")
+
+	err := remote.(s3fs.MetadataFS).PutWithMetadata(context.TODO(), "dir/data", strings.NewReader("{}"), s3fs.Metadata{ContentType: "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := get("/dir/data", nil, http.StatusOK, "{}").Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want the stored application/json", ct)
+	}
+
+	rsp, err = http.Head(ts.URL + "/dir/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || rsp.ContentLength != int64(len(content)) {
+		t.Fatalf("HEAD = %d, %d bytes", rsp.StatusCode, rsp.ContentLength)
+	}
+}
+
+func TestFileServerPresignRedirect(t *testing.T) {
+	_, remote := newRangeRecorder(t)
+	for name, content := range map[string]string{"small": "hi", "large": "hello world"} {
+		if err := remote.Put(context.TODO(), name, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := httptest.NewServer(s3fs.FileServer(remote, s3fs.WithPresignRedirect(10, time.Minute)))
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	rsp, err := client.Get(ts.URL + "/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if loc := rsp.Header.Get("Location"); rsp.StatusCode != http.StatusTemporaryRedirect || !strings.Contains(loc, "X-Amz-Signature=") {
+		t.Fatalf("GET large = %d, Location %q, want redirect to presigned url", rsp.StatusCode, loc)
+	}
+	rsp, err = http.Get(ts.URL + "/large") // follow the redirect
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if string(b) != "hello world" {
+		t.Fatalf("GET large via redirect = %q", b)
+	}
+
+	rsp, err = client.Get(ts.URL + "/small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("GET small = %d, want 200", rsp.StatusCode)
+	}
+}
+
+func TestFileServerDir(t *testing.T) {
+	dir := t.TempDir()
+	local := s3fs.DirFS(dir)
+	if err := local.Put(context.TODO(), "a.json", strings.NewReader(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s3fs.FileServer(local))
+	defer ts.Close()
+
+	rsp, err := http.Get(ts.URL + "/../a.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || string(b) != `{"a":1}` || rsp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET = %d %q %v", rsp.StatusCode, b, rsp.Header)
+	}
+	if etag := rsp.Header.Get("ETag"); !strings.HasPrefix(etag, `"7-`) {
+		t.Fatalf("ETag = %q, want one of size and modification time", etag)
+	}
+}
@@ -34,6 +34,63 @@ type ContextualReadFileFS interface {
 	ReadFileWithContext(ctx context.Context, name string) ([]byte, error)
 }
 
+// ContextualStatFS like fs.StatFS, but with an additional ctx param.
+type ContextualStatFS interface {
+	fs.StatFS
+
+	// StatWithContext gets the file info without downloading its content.
+	StatWithContext(ctx context.Context, name string) (fs.FileInfo, error)
+}
+
+// ETagger is implemented by the fs.FileInfo of objects, which reports the entity tag.
+type ETagger interface {
+	// ETag returns the entity tag, which changes whenever the content changes.
+	ETag() string
+}
+
+// Checksummer is implemented by the fs.FileInfo returned by Stat, which reports the checksum stored with the content.
+type Checksummer interface {
+	// Checksum returns the algorithm and the base64 checksum of the whole content, or empty ones if unknown.
+	Checksum() (ChecksumAlgorithm, string)
+}
+
+// RangeReadFS reads part of a file without downloading the rest.
+type RangeReadFS interface {
+	// ReadRange reads length bytes of the file from offset, or up to the end if length is negative.
+	ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+}
+
+// ListFS lists the files of the fs.
+type ListFS interface {
+	// List calls fn with the info of each file whose name has the prefix, where Name() returns the full name.
+	// Object storages list names in lexical order. It stops at the first error returned by fn.
+	List(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error
+}
+
+// ListAfterFS lists files by pages, e.g., for paging the s3 api.
+type ListAfterFS interface {
+	// ListAfter is like List, but lists the files whose names sort after the given one, in lexical order.
+	ListAfter(ctx context.Context, prefix, after string, fn func(fs.FileInfo) error) error
+}
+
+// ListDirFS lists a dir without the files under its sub dirs, e.g., by the delimiter "/" of s3.
+type ListDirFS interface {
+	// ListDir is like List, but lists the files and dirs right in the dir of the prefix only, where the infos of
+	// dirs are IsDir() and their names have no trailing slash.
+	ListDir(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error
+}
+
+// ContextualGlobFS like fs.GlobFS, but with an additional ctx param.
+// Only the files under the longest literal prefix of the pattern are listed, e.g., logs/2026-10- of
+// logs/2026-10-*/part-*.gz, and dirs are implied by the names of files.
+// As an extension, a "**" segment of the pattern matches zero or more segments of names, e.g., logs/**/*.gz.
+type ContextualGlobFS interface {
+	fs.GlobFS
+
+	// GlobWithContext returns the names of files and dirs matching the pattern with the context.
+	GlobWithContext(ctx context.Context, pattern string) ([]string, error)
+}
+
 // WriteFileFS lets you write, delete aws s3
 type WriteFileFS interface {
 	// Put creates a new file whose content reads from the reader
@@ -44,6 +101,42 @@ type WriteFileFS interface {
 	Delete(ctx context.Context, name string) error
 }
 
+// Metadata is stored along with the content of a file.
+type Metadata struct {
+	ContentType     string
+	ContentEncoding string
+	// User is the user-defined metadata, whose keys are read back in lower case.
+	// Keys had better be valid C# identifiers for azure blob, e.g., no hyphens.
+	User map[string]string
+}
+
+// MetadataFS writes files with metadata, which is read back by Stat as MetadataInfo.
+type MetadataFS interface {
+	// PutWithMetadata is like Put, but also stores the metadata of the file.
+	PutWithMetadata(ctx context.Context, name string, reader io.Reader, metadata Metadata) error
+}
+
+// MetadataInfo is implemented by the fs.FileInfo returned by Stat of a MetadataFS.
+type MetadataInfo interface {
+	// Metadata returns the metadata stored with the file.
+	Metadata() Metadata
+}
+
+// ResumableFS uploads large files by parts, which resumes after failures or crashes.
+type ResumableFS interface {
+	// PutResumable is like Put, but reads the file of the size by parts and persists the progress to the checkpoint
+	// file after each part. Calling it again with the same checkpoint uploads the missing parts only,
+	// the reader must have the same content. The checkpoint file is removed once completed.
+	PutResumable(ctx context.Context, name string, r io.ReaderAt, size int64, checkpoint string) error
+}
+
+// CopyFS copies files within the service, without downloading them.
+type CopyFS interface {
+	// CopyFrom copies the file srcName of the size from src to name, or returns errors.ErrUnsupported if it can't
+	// be copied within the service, e.g., src is of another service, in which case it should be downloaded.
+	CopyFrom(ctx context.Context, src FS, srcName, name string, size int64) error
+}
+
 // PresignFS creates url links to access the fs.
 type PresignFS interface {
 	// PresignGet generates a presigned HTTP url to get the object.
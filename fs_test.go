@@ -7,12 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -88,26 +90,84 @@ func TestPut(t *testing.T) {
 	// Output: hello
 }
 
-func newTestFs() (s3fs.FS, func()) {
-	backend := s3mem.New()
-	faker := gofakes3.New(backend, gofakes3.WithAutoBucket(true))
-	ts := httptest.NewServer(faker.Server())
-	fn := func() {
-		ts.Close()
+// testFsConfig is the fake s3 server and the fs created by newTestFs.
+type testFsConfig struct {
+	handler func(w http.ResponseWriter, r *http.Request, next http.Handler)
+	options []s3fs.Option
+	optFns  []func(*s3.Options)
+}
+
+// testOption configures newTestFs.
+type testOption func(c *testFsConfig)
+
+// withHandler intercepts the requests of the fake s3 server, e.g., to record or stall them,
+// it calls next.ServeHTTP to serve the request by the fake.
+func withHandler(handler func(w http.ResponseWriter, r *http.Request, next http.Handler)) testOption {
+	return func(c *testFsConfig) {
+		c.handler = handler
+	}
+}
+
+// countGets counts the GET requests of the fake s3 server.
+func countGets(gets *atomic.Int32) testOption {
+	return withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withOptions sets more options of the fs, which take precedence over the default ones.
+func withOptions(options ...s3fs.Option) testOption {
+	return func(c *testFsConfig) {
+		c.options = append(c.options, options...)
 	}
-	fs, _ := s3fs.New(
+}
+
+// withOptFns customizes the s3 client after the endpoint of the fake s3 server is set.
+func withOptFns(optFns ...func(*s3.Options)) testOption {
+	return func(c *testFsConfig) {
+		c.optFns = append(c.optFns, optFns...)
+	}
+}
+
+// newTestServer starts a fake s3 server creating buckets on demand, whose requests are intercepted by the handler
+// if not nil.
+func newTestServer(handler func(w http.ResponseWriter, r *http.Request, next http.Handler)) *httptest.Server {
+	faker := gofakes3.New(s3mem.New(), gofakes3.WithAutoBucket(true)).Server()
+	if handler == nil {
+		return httptest.NewServer(faker)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, faker)
+	}))
+}
+
+// newTestFs creates the fs of the bucket test-bucket of a fake s3 server, with 1 byte buffer size by default.
+// The returned func stops the server.
+func newTestFs(options ...testOption) (s3fs.NamespacedFS, func()) {
+	var c testFsConfig
+	for _, op := range options {
+		op(&c)
+	}
+	ts := newTestServer(c.handler)
+	fs, err := s3fs.New(append([]s3fs.Option{
 		s3fs.WithCredential("AK******", "SK******"),
 		s3fs.WithNamespace("test-bucket"),
 		s3fs.WithBufferSize(1),
-		// s3fs.WithEndpoint(ts.URL),
-		s3fs.WithOptFns(func(o *s3.Options) {
-			o.BaseEndpoint = &ts.URL // override endpoint above
+		s3fs.WithOptFns(append([]func(*s3.Options){func(o *s3.Options) {
+			o.BaseEndpoint = &ts.URL
 			o.HTTPClient = awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
 				t.TLSClientConfig.InsecureSkipVerify = true
 			})
-		}),
-	)
-	return fs, fn
+		}}, c.optFns...)...),
+	}, c.options...)...)
+	if err != nil {
+		ts.Close()
+		panic(err)
+	}
+	return fs, ts.Close
 }
 
 func TestBaiscS3Operations(t *testing.T) {
@@ -152,6 +212,23 @@ func TestBaiscS3Operations(t *testing.T) {
 	}
 }
 
+func TestDeleteNotFound(t *testing.T) {
+	// s3 deletes missing keys silently, but some compatible services respond 404
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Method == http.MethodDelete {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+	defer done()
+	if err := fs.Delete(context.TODO(), "missing"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("Delete of missing file got %v, want fs.ErrNotExist", err)
+	}
+}
+
 func TestScanner(t *testing.T) {
 	content := `line1
 line2
@@ -0,0 +1,277 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm       = "AWS4-HMAC-SHA256"
+	timeFormat      = "20060102T150405Z"
+	maxSkew         = 15 * time.Minute
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	emptySHA256     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	streamingSigned        = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingSignedTrailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsigned      = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+// signature is a verified sigv4 signature, which seeds the signatures of aws-chunked payloads.
+type signature struct {
+	key       []byte // signing key
+	date      string // X-Amz-Date
+	scope     string // <date>/<region>/<service>/aws4_request
+	signature string
+}
+
+// authenticate verifies the sigv4 signature in either the Authorization header or the presigned url query.
+// It returns nil without credentials configured, i.e., anonymous access.
+func (s *Server) authenticate(r *http.Request) (*signature, error) {
+	if len(s.credentials) == 0 {
+		return nil, nil
+	}
+	q := r.URL.Query()
+	var (
+		credential, signedHeaders, sig, date, payload string
+		presigned                                     = q.Has("X-Amz-Signature")
+	)
+	if presigned {
+		if q.Get("X-Amz-Algorithm") != algorithm {
+			return nil, errAuthorizationHeaderMalformed
+		}
+		credential, signedHeaders, sig = q.Get("X-Amz-Credential"), q.Get("X-Amz-SignedHeaders"), q.Get("X-Amz-Signature")
+		date, payload = q.Get("X-Amz-Date"), unsignedPayload
+	} else {
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), algorithm+" ")
+		if !ok {
+			return nil, errAccessDenied
+		}
+		for part := range strings.SplitSeq(auth, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch k {
+			case "Credential":
+				credential = v
+			case "SignedHeaders":
+				signedHeaders = v
+			case "Signature":
+				sig = v
+			}
+		}
+		date, payload = r.Header.Get("X-Amz-Date"), r.Header.Get("X-Amz-Content-Sha256")
+		if payload == "" {
+			payload = emptySHA256
+		}
+	}
+	if credential == "" || signedHeaders == "" || sig == "" || date == "" {
+		return nil, errAuthorizationHeaderMalformed
+	}
+
+	accessKey, scope, ok := strings.Cut(credential, "/")
+	scopes := strings.Split(scope, "/")
+	if !ok || len(scopes) != 4 || scopes[2] != "s3" || scopes[3] != "aws4_request" || !strings.HasPrefix(date, scopes[0]) {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	if s.region != "" && scopes[1] != s.region {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	secretKey, ok := s.credentials[accessKey]
+	if !ok {
+		return nil, errInvalidAccessKeyID
+	}
+
+	t, err := time.Parse(timeFormat, date)
+	if err != nil {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	now := time.Now()
+	if presigned {
+		expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if err != nil || expires < 0 {
+			return nil, errAuthorizationHeaderMalformed
+		}
+		if now.After(t.Add(time.Duration(expires) * time.Second)) {
+			return nil, errExpiredToken
+		}
+	} else if now.Sub(t).Abs() > maxSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(q),
+		canonicalHeaders(r, signedHeaders),
+		signedHeaders,
+		payload,
+	}, "\n")
+	key := signingKey(secretKey, scopes[0], scopes[1], scopes[2])
+	want := hmacHex(key, stringToSign(date, scope, canonical))
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return nil, errSignatureDoesNotMatch
+	}
+	return &signature{key: key, date: date, scope: scope, signature: sig}, nil
+}
+
+func stringToSign(date, scope, canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return algorithm + "\n" + date + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+}
+
+func signingKey(secretKey, date, region, service string) []byte {
+	key := hmacSum([]byte("AWS4"+secretKey), date)
+	key = hmacSum(key, region)
+	key = hmacSum(key, service)
+	return hmacSum(key, "aws4_request")
+}
+
+func hmacSum(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hmacHex(key []byte, data string) string {
+	return hex.EncodeToString(hmacSum(key, data))
+}
+
+// uriEncode encodes s by rfc 3986 like aws does, i.e., every byte except the unreserved characters,
+// and slashes unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	var params []string
+	for k, vs := range q {
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range vs {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	slices.Sort(params)
+	return strings.Join(params, "&")
+}
+
+func canonicalHeaders(r *http.Request, signedHeaders string) string {
+	var b strings.Builder
+	for name := range strings.SplitSeq(signedHeaders, ";") {
+		var values []string
+		if name == "host" {
+			values = []string{r.Host}
+		} else {
+			values = r.Header.Values(name)
+		}
+		for i, v := range values {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return b.String()
+}
+
+// chunkedReader decodes the aws-chunked payload, and verifies the signature of each chunk if signed.
+// Trailing checksums are not verified.
+type chunkedReader struct {
+	r      *bufio.Reader
+	sig    *signature // nil for unsigned payloads
+	prev   string     // signature of the previous chunk
+	chunk  []byte
+	err    error
+	maxLen int
+}
+
+func newChunkedReader(body io.Reader, sig *signature) *chunkedReader {
+	cr := &chunkedReader{r: bufio.NewReader(body), sig: sig, maxLen: 16 << 20}
+	if sig != nil {
+		cr.prev = sig.signature
+	}
+	return cr
+}
+
+// Read implements io.Reader.
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for len(cr.chunk) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		cr.err = cr.next()
+	}
+	n := copy(p, cr.chunk)
+	cr.chunk = cr.chunk[n:]
+	return n, nil
+}
+
+// next reads the next chunk, i.e., <hex-size>[;chunk-signature=<sig>]\r\n<data>\r\n, it returns io.EOF after
+// the last chunk of size zero and the trailers.
+func (cr *chunkedReader) next() error {
+	line, err := cr.line()
+	if err != nil {
+		return err
+	}
+	sizeHex, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > int64(cr.maxLen) {
+		return errIncompleteBody
+	}
+	chunk := make([]byte, size)
+	if _, err := io.ReadFull(cr.r, chunk); err != nil {
+		return errIncompleteBody
+	}
+	if cr.sig != nil {
+		sig, _ := strings.CutPrefix(ext, "chunk-signature=")
+		sum := sha256.Sum256(chunk)
+		want := hmacHex(cr.sig.key, strings.Join([]string{
+			algorithm + "-PAYLOAD", cr.sig.date, cr.sig.scope, cr.prev, emptySHA256, hex.EncodeToString(sum[:]),
+		}, "\n"))
+		if !hmac.Equal([]byte(sig), []byte(want)) {
+			return errSignatureDoesNotMatch
+		}
+		cr.prev = sig
+	}
+	if size == 0 {
+		for { // trailers end with an empty line
+			if line, err := cr.line(); err != nil || line == "" {
+				return io.EOF
+			}
+		}
+	}
+	if line, err := cr.line(); err != nil || line != "" {
+		return errIncompleteBody
+	}
+	cr.chunk = chunk
+	return nil
+}
+
+func (cr *chunkedReader) line() (string, error) {
+	line, err := cr.r.ReadSlice('\n')
+	if err != nil {
+		return "", errIncompleteBody
+	}
+	return string(bytes.TrimRight(line, "\r\n")), nil
+}
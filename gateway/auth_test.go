@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// chunked encodes the chunks in aws-chunked signed by sig.
+func chunked(sig *signature, chunks ...string) string {
+	var b strings.Builder
+	prev := sig.signature
+	for _, chunk := range append(chunks, "") {
+		sum := sha256.Sum256([]byte(chunk))
+		prev = hmacHex(sig.key, strings.Join([]string{
+			algorithm + "-PAYLOAD", sig.date, sig.scope, prev, emptySHA256, hex.EncodeToString(sum[:]),
+		}, "\n"))
+		fmt.Fprintf(&b, "%x;chunk-signature=%s\r\n%s\r\n", len(chunk), prev, chunk)
+	}
+	return b.String()
+}
+
+func TestChunkedReader(t *testing.T) {
+	sig := &signature{
+		key:       signingKey("SECRET", "20260101", "us-east-1", "s3"),
+		date:      "20260101T000000Z",
+		scope:     "20260101/us-east-1/s3/aws4_request",
+		signature: "seed",
+	}
+	body := chunked(sig, "hello ", "world")
+	b, err := io.ReadAll(newChunkedReader(strings.NewReader(body), sig))
+	if err != nil || string(b) != "hello world" {
+		t.Fatalf("read = %q, %v", b, err)
+	}
+
+	tampered := strings.Replace(body, "world", "WORLD", 1)
+	if _, err := io.ReadAll(newChunkedReader(strings.NewReader(tampered), sig)); err != errSignatureDoesNotMatch {
+		t.Fatalf("read tampered = %v, want %v", err, errSignatureDoesNotMatch)
+	}
+
+	unsigned := "6\r\nhello \r\n5\r\nworld\r\n0\r\nx-amz-checksum-crc32:AAAAAA==\r\n\r\n"
+	b, err = io.ReadAll(newChunkedReader(strings.NewReader(unsigned), nil))
+	if err != nil || string(b) != "hello world" {
+		t.Fatalf("read unsigned = %q, %v", b, err)
+	}
+}
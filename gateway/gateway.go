@@ -0,0 +1,279 @@
+// Package gateway serves s3fs.FS by a minimal s3 compatible http api, so that tools speaking s3 only can access
+// local dirs, azure blob containers and so on.
+//
+// It supports path-style requests of GetObject, HeadObject, PutObject, CopyObject, DeleteObject, ListObjects(V2),
+// ListBuckets, HeadBucket and multipart uploads, signed by aws signature version 4.
+package gateway
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/longkai/s3fs"
+)
+
+// Option configures the Server.
+type Option func(s *Server)
+
+// WithBucket serves the fs as the bucket of the name.
+func WithBucket(name string, fsys s3fs.FS) Option {
+	return func(s *Server) {
+		s.buckets[name] = fsys
+	}
+}
+
+// WithCredential accepts requests signed by the key pair, it can be set multiple times for more keys.
+// Without any credentials, requests are not authenticated.
+func WithCredential(accessKey, secretKey string) Option {
+	return func(s *Server) {
+		s.credentials[accessKey] = secretKey
+	}
+}
+
+// WithRegion accepts requests signed for the region only, any regions are accepted by default.
+func WithRegion(region string) Option {
+	return func(s *Server) {
+		s.region = region
+	}
+}
+
+// Server is a http.Handler of the s3 api.
+type Server struct {
+	buckets     map[string]s3fs.FS
+	credentials map[string]string // access key -> secret key
+	region      string
+}
+
+// New creates the server of the buckets set by WithBucket.
+func New(options ...Option) *Server {
+	s := &Server{
+		buckets:     make(map[string]s3fs.FS),
+		credentials: make(map[string]string),
+	}
+	for _, op := range options {
+		op(s)
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sig, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		s.listBuckets(w, r)
+		return
+	}
+	fsys, ok := s.buckets[bucket]
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+
+	q := r.URL.Query()
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+		case http.MethodGet:
+			s.listObjects(w, r, bucket, fsys)
+		default:
+			writeError(w, r, errNotImplemented)
+		}
+		return
+	}
+	if !validKey(key) {
+		writeError(w, r, errInvalidObjectName)
+		return
+	}
+	if strings.HasPrefix(key, multipartPrefix) {
+		writeError(w, r, errAccessDenied)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.createMultipartUpload(w, r, bucket, key, fsys)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		s.completeMultipartUpload(w, r, bucket, key, fsys)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		s.uploadPart(w, r, sig, key, fsys)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		s.abortMultipartUpload(w, r, key, fsys)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, key, fsys)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, sig, key, fsys)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		r.URL.Path = "/" + key
+		s3fs.FileServer(fsys, s3fs.WithErrorHandler(writeError)).ServeHTTP(w, r)
+	case r.Method == http.MethodDelete:
+		if err := fsys.Delete(r.Context(), key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, errMethodNotAllowed)
+	}
+}
+
+// validKey reports whether the key is a valid name of s3fs.FS, i.e., fs.ValidPath and not ".", thus no ".." or
+// empty segments escaping the bucket, e.g., the dir of s3fs.DirFS, or reaching the hidden multipartPrefix.
+// Folder markers, i.e., keys with a trailing slash, are valid as well, which fs of dirs refuse to write though.
+func validKey(key string) bool {
+	key = strings.TrimSuffix(key, "/")
+	return fs.ValidPath(key) && key != "."
+}
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+// putObject writes the body to the file, the ETag is the md5 of the content like s3.
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, sig *signature, key string, fsys s3fs.FS) {
+	etag, err := put(r, sig, fsys, key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+}
+
+// put writes the request body to the file, and returns its quoted md5 hex. The body is spilled to a temp file
+// until verified, i.e., its sha256 if signed and the signatures of its chunks if streaming, so that a bad or
+// broken request never overwrites, nor leaves a partial file.
+func put(r *http.Request, sig *signature, fsys s3fs.FS, name string) (string, error) {
+	var body io.Reader = r.Body
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	switch payload {
+	case streamingSigned, streamingSignedTrailer:
+		body = newChunkedReader(r.Body, sig)
+	case streamingUnsigned:
+		body = newChunkedReader(r.Body, nil)
+	}
+	tmp, err := os.CreateTemp("", "s3fs-gateway-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	md5sum, sha := md5.New(), sha256.New()
+	if _, err := io.Copy(tmp, io.TeeReader(body, io.MultiWriter(md5sum, sha))); err != nil {
+		return "", err
+	}
+	if sig != nil && len(payload) == sha256.Size*2 && hex.EncodeToString(sha.Sum(nil)) != payload {
+		return "", errBadDigest
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := fsys.Put(r.Context(), name, tmp); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(md5sum.Sum(nil)) + `"`, nil
+}
+
+// copyObject copies the file of X-Amz-Copy-Source, i.e., [/]<bucket>/<key>[?versionId=<id>], by streaming.
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, key string, fsys s3fs.FS) {
+	src, _, _ := strings.Cut(r.Header.Get("X-Amz-Copy-Source"), "?")
+	src, err := url.PathUnescape(strings.TrimPrefix(src, "/"))
+	if err != nil {
+		writeError(w, r, errInvalidArgument)
+		return
+	}
+	srcBucket, srcKey, _ := strings.Cut(src, "/")
+	srcFs, ok := s.buckets[srcBucket]
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	if !validKey(srcKey) {
+		writeError(w, r, errInvalidObjectName)
+		return
+	}
+	if strings.HasPrefix(srcKey, multipartPrefix) {
+		writeError(w, r, errNoSuchKey)
+		return
+	}
+
+	ctx := r.Context()
+	var rc io.ReadCloser
+	if rr, ok := srcFs.(s3fs.RangeReadFS); ok {
+		rc, err = rr.ReadRange(ctx, srcKey, 0, -1)
+	} else {
+		rc, err = srcFs.OpenWithContext(ctx, srcKey)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer rc.Close()
+	sum := md5.New()
+	if err := fsys.Put(ctx, key, io.TeeReader(rc, sum)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		Xmlns        string   `xml:"xmlns,attr"`
+		LastModified string
+		ETag         string
+	}{Xmlns: xmlns, LastModified: formatTime(time.Now()), ETag: `"` + hex.EncodeToString(sum.Sum(nil)) + `"`})
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter, r *http.Request) {
+	type bucket struct {
+		Name         string
+		CreationDate string
+	}
+	var buckets []bucket
+	for _, name := range slices.Sorted(maps.Keys(s.buckets)) {
+		buckets = append(buckets, bucket{Name: name, CreationDate: formatTime(time.Time{})})
+	}
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Owner   struct{ ID string }
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{Xmlns: xmlns, Buckets: buckets})
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// etag returns the quoted ETag of the file, or one made of its size and modification time like s3fs.FileServer.
+func etag(info fs.FileInfo) string {
+	if e, ok := info.(s3fs.ETagger); ok && e.ETag() != "" {
+		if tag := e.ETag(); strings.HasPrefix(tag, `"`) {
+			return tag
+		}
+		return `"` + e.ETag() + `"`
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
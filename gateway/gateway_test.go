@@ -0,0 +1,349 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/longkai/s3fs"
+	"github.com/longkai/s3fs/gateway"
+)
+
+func newClient(t *testing.T, endpoint, ak, sk string) s3fs.FS {
+	t.Helper()
+	fs, err := s3fs.New(
+		s3fs.WithCredential(ak, sk),
+		s3fs.WithNamespace("bucket"),
+		s3fs.WithOptFns(func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestGateway(t *testing.T) {
+	dir := t.TempDir()
+	ts := httptest.NewServer(gateway.New(
+		gateway.WithBucket("bucket", s3fs.DirFS(dir)),
+		gateway.WithCredential("AKID", "SECRET"),
+	))
+	defer ts.Close()
+	client := newClient(t, ts.URL, "AKID", "SECRET")
+	ctx := context.TODO()
+
+	for name, content := range map[string]string{"a.txt": "hello", "dir/b.txt": "world", "dir/sub/c.txt": "!"} {
+		if err := client.Put(ctx, name, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "dir", "b.txt")); err != nil || string(b) != "world" {
+		t.Fatalf("put file = %q, %v", b, err)
+	}
+	if b, err := client.ReadFile("dir/b.txt"); err != nil || string(b) != "world" {
+		t.Fatalf("ReadFile = %q, %v", b, err)
+	}
+	rc, err := client.(s3fs.RangeReadFS).ReadRange(ctx, "a.txt", 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "ell" {
+		t.Fatalf("ReadRange = %q, want %q", b, "ell")
+	}
+	info, err := client.(s3fs.ContextualStatFS).Stat("a.txt")
+	if err != nil || info.Size() != 5 {
+		t.Fatalf("Stat = %v, %v", info, err)
+	}
+	if _, err := client.(s3fs.ContextualStatFS).Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat missing = %v, want fs.ErrNotExist", err)
+	}
+
+	var names []string
+	err = client.(s3fs.ListFS).List(ctx, "dir/", func(info fs.FileInfo) error {
+		names = append(names, info.Name())
+		return nil
+	})
+	if err != nil || strings.Join(names, ",") != "dir/b.txt,dir/sub/c.txt" {
+		t.Fatalf("List = %v, %v", names, err)
+	}
+	out, err := client.(interface{ Client() *s3.Client }).Client().ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String("bucket"),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Contents) != 1 || *out.Contents[0].Key != "a.txt" || !*out.IsTruncated {
+		t.Fatalf("ListObjectsV2 = %+v", out)
+	}
+	out, err = client.(interface{ Client() *s3.Client }).Client().ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:            aws.String("bucket"),
+		Delimiter:         aws.String("/"),
+		ContinuationToken: out.NextContinuationToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.CommonPrefixes) != 1 || *out.CommonPrefixes[0].Prefix != "dir/" || *out.IsTruncated {
+		t.Fatalf("ListObjectsV2 next page = %+v", out)
+	}
+
+	// multipart upload by the uploader, 5 MiB per part
+	large := bytes.Repeat([]byte("0123456789abcdef"), 700<<10)
+	if err := client.Put(ctx, "large", bytes.NewReader(large)); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "large")); err != nil || !bytes.Equal(b, large) {
+		t.Fatalf("multipart uploaded %d bytes, %v, want %d", len(b), err, len(large))
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".s3fs-multipart")); err == nil {
+		entries, _ := os.ReadDir(filepath.Join(dir, ".s3fs-multipart"))
+		for _, e := range entries {
+			if sub, _ := os.ReadDir(filepath.Join(dir, ".s3fs-multipart", e.Name())); len(sub) > 0 {
+				t.Fatalf("parts left after completed: %v", sub)
+			}
+		}
+	}
+
+	url, err := client.(s3fs.PresignFS).PresignGet(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || string(b) != "hello" {
+		t.Fatalf("GET presigned url = %d %q", rsp.StatusCode, b)
+	}
+
+	if err := client.Delete(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("deleted file still exists: %v", err)
+	}
+}
+
+func TestGatewayAuth(t *testing.T) {
+	ts := httptest.NewServer(gateway.New(
+		gateway.WithBucket("bucket", s3fs.DirFS(t.TempDir())),
+		gateway.WithCredential("AKID", "SECRET"),
+	))
+	defer ts.Close()
+
+	for _, tt := range []struct{ ak, sk string }{{"AKID", "WRONG"}, {"UNKNOWN", "SECRET"}} {
+		client := newClient(t, ts.URL, tt.ak, tt.sk)
+		if err := client.Put(context.TODO(), "a.txt", strings.NewReader("hello")); err == nil {
+			t.Fatalf("Put with %s:%s should fail", tt.ak, tt.sk)
+		}
+	}
+	rsp, err := http.Get(ts.URL + "/bucket/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusForbidden {
+		t.Fatalf("anonymous GET = %d, want 403", rsp.StatusCode)
+	}
+}
+
+func TestGatewayTraversal(t *testing.T) {
+	root := t.TempDir()
+	data := filepath.Join(root, "data")
+	ts := httptest.NewServer(gateway.New(gateway.WithBucket("bucket", s3fs.DirFS(data)))) // anonymous
+	defer ts.Close()
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path string, header http.Header) int {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader("escaped"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		maps.Copy(req.Header, header)
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		return rsp.StatusCode
+	}
+	for _, path := range []string{
+		"/bucket/..%2Fescaped.txt",
+		"/bucket/a%2F..%2F..%2Fescaped.txt",
+		"/bucket/.%2F.s3fs-multipart%2Fx",
+		"/bucket/a%2F%2Fb",
+	} {
+		for _, method := range []string{http.MethodPut, http.MethodDelete, http.MethodPost + "?uploads"} {
+			method, query, _ := strings.Cut(method, "?")
+			if code := do(method, path+"?"+query, nil); code != http.StatusBadRequest {
+				t.Fatalf("%s %s = %d, want 400", method, path, code)
+			}
+		}
+	}
+	if code := do(http.MethodPut, "/bucket/copied.txt", http.Header{
+		"X-Amz-Copy-Source": {"bucket/..%2Fsecret.txt"},
+	}); code != http.StatusBadRequest {
+		t.Fatalf("copy from ../secret.txt = %d, want 400", code)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped.txt")); !os.IsNotExist(err) {
+		t.Fatalf("file written out of the bucket: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(data, "copied.txt")); !os.IsNotExist(err) {
+		t.Fatalf("file copied from out of the bucket: %v", err)
+	}
+
+	// the dir fs itself resolves names under its dir only
+	fsys := s3fs.DirFS(data)
+	if err := fsys.Put(context.TODO(), "../escaped.txt", strings.NewReader("escaped")); err == nil {
+		t.Fatal("Put ../escaped.txt should fail")
+	}
+	if _, err := fsys.ReadFile("../secret.txt"); err == nil {
+		t.Fatal("ReadFile ../secret.txt should fail")
+	}
+}
+
+func TestGatewayBadDigest(t *testing.T) {
+	dir := t.TempDir()
+	ts := httptest.NewServer(gateway.New(
+		gateway.WithBucket("bucket", s3fs.DirFS(dir)),
+		gateway.WithCredential("AKID", "SECRET"),
+	))
+	defer ts.Close()
+	if err := newClient(t, ts.URL, "AKID", "SECRET").Put(context.TODO(), "a.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	body := "overwritten"
+	sum := sha256.Sum256([]byte("something else"))
+	payload := hex.EncodeToString(sum[:])
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/bucket/a.txt", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	creds := aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}
+	if err := v4.NewSigner().SignHTTP(context.TODO(), creds, req, payload, "s3", "us-east-1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("PUT of bad digest = %d, want 400", rsp.StatusCode)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(b) != "hello" {
+		t.Fatalf("file after PUT of bad digest = %q, %v, want it untouched", b, err)
+	}
+}
+
+// countingFS counts the files listed from the fs.
+type countingFS struct {
+	s3fs.FS
+	listed atomic.Int32
+}
+
+func (c *countingFS) List(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error {
+	return c.FS.(s3fs.ListFS).List(ctx, prefix, fn)
+}
+
+func (c *countingFS) ListAfter(ctx context.Context, prefix, after string, fn func(fs.FileInfo) error) error {
+	return c.FS.(s3fs.ListAfterFS).ListAfter(ctx, prefix, after, func(info fs.FileInfo) error {
+		c.listed.Add(1)
+		return fn(info)
+	})
+}
+
+func TestGatewayList(t *testing.T) {
+	dir := t.TempDir()
+	fsys := &countingFS{FS: s3fs.DirFS(dir)}
+	backend := httptest.NewServer(gofakes3.New(s3mem.New(), gofakes3.WithAutoBucket(true)).Server())
+	defer backend.Close()
+	ts := httptest.NewServer(gateway.New(
+		gateway.WithBucket("bucket", fsys),
+		gateway.WithBucket("objects", newClient(t, backend.URL, "AK", "SK")),
+		gateway.WithCredential("AKID", "SECRET"),
+	))
+	defer ts.Close()
+	client := newClient(t, ts.URL, "AKID", "SECRET")
+	cli := client.(interface{ Client() *s3.Client }).Client()
+	ctx := context.TODO()
+
+	var want []string
+	for _, name := range []string{"a-b", "a.txt", "a/b", "a/c/d", "b/c", "c.txt", "d/e/f"} {
+		if err := client.Put(ctx, name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, name)
+	}
+	slices.Sort(want)
+	fsys.listed.Store(0)
+	var got []string
+	pages := 0
+	p := s3.NewListObjectsV2Paginator(cli, &s3.ListObjectsV2Input{Bucket: aws.String("bucket"), MaxKeys: aws.Int32(2)})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, obj := range out.Contents {
+			got = append(got, *obj.Key)
+		}
+		pages++
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("listed %v by pages, want %v", got, want)
+	}
+	if n := fsys.listed.Load(); n > int32(pages*3) {
+		t.Fatalf("listed %d files for %d pages of 2 keys, want at most 3 each", n, pages)
+	}
+
+	// folder markers
+	for _, bucket := range []string{"bucket", "objects"} {
+		_, err := cli.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String("folder/"), Body: strings.NewReader("")})
+		var apiErr smithy.APIError
+		switch {
+		case bucket == "objects" && err != nil:
+			t.Fatalf("put folder marker to the object storage: %v", err)
+		case bucket == "bucket" && (!errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidObjectName"):
+			t.Fatalf("put folder marker to the dir = %v, want InvalidObjectName", err)
+		}
+	}
+	out, err := cli.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String("objects"), Prefix: aws.String("folder/")})
+	if err != nil || len(out.Contents) != 1 || *out.Contents[0].Key != "folder/" {
+		t.Fatalf("ListObjectsV2 of the folder marker = %+v, %v", out, err)
+	}
+}
@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/longkai/s3fs"
+)
+
+type listEntry struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+// listObjects serves both ListObjects and ListObjectsV2 of the bucket.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string, fsys s3fs.FS) {
+	l, ok := fsys.(s3fs.ListFS)
+	if !ok {
+		writeError(w, r, errNotImplemented)
+		return
+	}
+	q := r.URL.Query()
+	v2 := q.Get("list-type") == "2"
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	maxKeys := 1000
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, errInvalidArgument)
+			return
+		}
+		maxKeys = min(n, maxKeys)
+	}
+	after := q.Get("marker")
+	if v2 {
+		after = q.Get("start-after")
+		if token := q.Get("continuation-token"); token != "" {
+			b, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				writeError(w, r, errInvalidArgument)
+				return
+			}
+			after = max(after, string(b))
+		}
+	}
+
+	// the page of keys and common prefixes after the marker, stops listing once full if listed in order
+	pg := &page{size: maxKeys + 1}
+	visit := func(info fs.FileInfo) error {
+		name := info.Name()
+		if strings.HasPrefix(name, multipartPrefix) || name <= after {
+			return nil
+		}
+		item := pageItem{name: name, info: info}
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				item = pageItem{name: name[:len(prefix)+i+len(delimiter)]}
+				if item.name <= after {
+					return nil // in the common prefix listed already
+				}
+			}
+		}
+		if pg.add(item) {
+			return errPageFull
+		}
+		return nil
+	}
+	var err error
+	if la, ok := l.(s3fs.ListAfterFS); ok {
+		err = la.ListAfter(r.Context(), prefix, after, visit)
+	} else {
+		err = l.List(r.Context(), prefix, func(info fs.FileInfo) error {
+			_ = visit(info) // not in order, the page is only full once all listed
+			return nil
+		})
+	}
+	if err != nil && !errors.Is(err, errPageFull) {
+		writeError(w, r, err)
+		return
+	}
+
+	var (
+		contents  []listEntry
+		prefixes  []commonPrefix
+		last      string
+		truncated = len(pg.items) > maxKeys
+	)
+	for _, item := range pg.items[:min(len(pg.items), maxKeys)] {
+		if item.info == nil {
+			prefixes = append(prefixes, commonPrefix{item.name})
+		} else {
+			contents = append(contents, listEntry{
+				Key:          item.name,
+				LastModified: formatTime(item.info.ModTime()),
+				ETag:         etag(item.info),
+				Size:         item.info.Size(),
+				StorageClass: "STANDARD",
+			})
+		}
+		last = item.name
+	}
+
+	encode := func(s string) string { return s }
+	encodingType := q.Get("encoding-type")
+	if encodingType == "url" {
+		encode = func(s string) string { return strings.ReplaceAll(url.QueryEscape(s), "%2F", "/") }
+		for i := range contents {
+			contents[i].Key = encode(contents[i].Key)
+		}
+		for i := range prefixes {
+			prefixes[i].Prefix = encode(prefixes[i].Prefix)
+		}
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Xmlns                 string   `xml:"xmlns,attr"`
+		Name                  string
+		Prefix                string
+		Delimiter             string `xml:",omitempty"`
+		EncodingType          string `xml:",omitempty"`
+		MaxKeys               int
+		IsTruncated           bool
+		Marker                *string `xml:",omitempty"`
+		NextMarker            string  `xml:",omitempty"`
+		KeyCount              *int    `xml:",omitempty"`
+		StartAfter            string  `xml:",omitempty"`
+		ContinuationToken     string  `xml:",omitempty"`
+		NextContinuationToken string  `xml:",omitempty"`
+		Contents              []listEntry
+		CommonPrefixes        []commonPrefix
+	}{
+		Xmlns:          xmlns,
+		Name:           bucket,
+		Prefix:         encode(prefix),
+		Delimiter:      encode(delimiter),
+		EncodingType:   encodingType,
+		MaxKeys:        maxKeys,
+		IsTruncated:    truncated,
+		Contents:       contents,
+		CommonPrefixes: prefixes,
+	}
+	if v2 {
+		n := len(contents) + len(prefixes)
+		result.KeyCount = &n
+		result.StartAfter = encode(q.Get("start-after"))
+		result.ContinuationToken = q.Get("continuation-token")
+		if truncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		}
+	} else {
+		marker := encode(q.Get("marker"))
+		result.Marker = &marker
+		if truncated && delimiter != "" {
+			result.NextMarker = encode(last)
+		}
+	}
+	writeXML(w, result)
+}
+
+// errPageFull stops listing once the page is full.
+var errPageFull = errors.New("page full")
+
+// page keeps the first keys and common prefixes of the size by name, which may be added in any order.
+type page struct {
+	size  int
+	items []pageItem
+}
+
+// pageItem is a key, or a common prefix without the info.
+type pageItem struct {
+	name string
+	info fs.FileInfo
+}
+
+// add adds the item unless added already or beyond the page, and reports whether the page is full.
+func (p *page) add(item pageItem) bool {
+	i, found := slices.BinarySearchFunc(p.items, item.name, func(e pageItem, name string) int {
+		return strings.Compare(e.name, name)
+	})
+	if !found && i < p.size {
+		p.items = slices.Insert(p.items, i, item)
+		if len(p.items) > p.size {
+			p.items = p.items[:p.size]
+		}
+	}
+	return len(p.items) == p.size
+}
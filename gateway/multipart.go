@@ -0,0 +1,230 @@
+package gateway
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/longkai/s3fs"
+)
+
+// multipartPrefix is where the parts of multipart uploads are kept in the fs of the bucket until completed,
+// i.e., <multipartPrefix><upload id>/key for the key of the upload, <multipartPrefix><upload id>/<part> and
+// <multipartPrefix><upload id>/<part>.etag for each part. It's hidden from the s3 api.
+const multipartPrefix = ".s3fs-multipart/"
+
+func uploadDir(uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", errNoSuchUpload
+	}
+	return multipartPrefix + uploadID + "/", nil
+}
+
+// checkUpload checks the upload exists for the key, and returns its dir.
+func checkUpload(ctx context.Context, r *http.Request, fsys s3fs.FS, key string) (string, error) {
+	dir, err := uploadDir(r.URL.Query().Get("uploadId"))
+	if err != nil {
+		return "", err
+	}
+	b, err := fsys.ReadFileWithContext(ctx, dir+"key")
+	if errors.Is(err, fs.ErrNotExist) || err == nil && string(b) != key {
+		return "", errNoSuchUpload
+	}
+	return dir, err
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string, fsys s3fs.FS) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	uploadID := hex.EncodeToString(id)
+	dir, _ := uploadDir(uploadID)
+	if err := fsys.Put(r.Context(), dir+"key", strings.NewReader(key)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Xmlns: xmlns, Bucket: bucket, Key: key, UploadId: uploadID})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, sig *signature, key string, fsys s3fs.FS) {
+	ctx := r.Context()
+	dir, err := checkUpload(ctx, r, fsys, key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	part, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || part < 1 || part > 10000 {
+		writeError(w, r, errInvalidArgument)
+		return
+	}
+	name := partName(dir, part)
+	etag, err := put(r, sig, fsys, name)
+	if err == nil {
+		err = fsys.Put(ctx, name+".etag", strings.NewReader(etag))
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+}
+
+func partName(dir string, part int) string {
+	return fmt.Sprintf("%s%05d", dir, part)
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string, fsys s3fs.FS) {
+	ctx := r.Context()
+	dir, err := checkUpload(ctx, r, fsys, key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req struct {
+		Parts []completedPart `xml:"Part"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || len(req.Parts) == 0 {
+		writeError(w, r, errMalformedXML)
+		return
+	}
+
+	names := make([]string, len(req.Parts))
+	sums := md5.New()
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(w, r, errInvalidPartOrder)
+			return
+		}
+		sum, err := hex.DecodeString(strings.Trim(p.ETag, `"`))
+		if err != nil || len(sum) != md5.Size {
+			writeError(w, r, errInvalidPart)
+			return
+		}
+		sums.Write(sum)
+		names[i] = partName(dir, p.PartNumber)
+		etag, err := fsys.ReadFileWithContext(ctx, names[i]+".etag")
+		if errors.Is(err, fs.ErrNotExist) || err == nil && strings.Trim(string(etag), `"`) != strings.Trim(p.ETag, `"`) {
+			err = errInvalidPart
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	parts := &partsReader{ctx: ctx, fsys: fsys, names: names}
+	defer parts.Close()
+	if err := fsys.Put(ctx, key, parts); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	removeAll(context.WithoutCancel(ctx), fsys, dir)
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{
+		Xmlns:    xmlns,
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     fmt.Sprintf(`"%x-%d"`, sums.Sum(nil), len(names)),
+	})
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, key string, fsys s3fs.FS) {
+	ctx := r.Context()
+	dir, err := checkUpload(ctx, r, fsys, key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	removeAll(ctx, fsys, dir)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeAll removes the files with the prefix, errors are ignored.
+func removeAll(ctx context.Context, fsys s3fs.FS, prefix string) {
+	l, ok := fsys.(s3fs.ListFS)
+	if !ok {
+		return
+	}
+	var names []string
+	_ = l.List(ctx, prefix, func(info fs.FileInfo) error {
+		names = append(names, info.Name())
+		return nil
+	})
+	for _, name := range names {
+		_ = fsys.Delete(ctx, name)
+	}
+}
+
+// partsReader reads the parts one after another, opening each lazily.
+type partsReader struct {
+	ctx   context.Context
+	fsys  s3fs.FS
+	names []string
+	cur   io.ReadCloser
+}
+
+// Read implements io.Reader.
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if len(p.names) == 0 {
+				return 0, io.EOF
+			}
+			var err error
+			if rr, ok := p.fsys.(s3fs.RangeReadFS); ok {
+				p.cur, err = rr.ReadRange(p.ctx, p.names[0], 0, -1)
+			} else {
+				p.cur, err = p.fsys.OpenWithContext(p.ctx, p.names[0])
+			}
+			if err != nil {
+				return 0, err
+			}
+			p.names = p.names[1:]
+		}
+		n, err := p.cur.Read(b)
+		if err == io.EOF {
+			p.Close()
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close closes the part being read.
+func (p *partsReader) Close() error {
+	if p.cur == nil {
+		return nil
+	}
+	err := p.cur.Close()
+	p.cur = nil
+	return err
+}
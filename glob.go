@@ -0,0 +1,123 @@
+package s3fs
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// glob matches the names of files, along with the dirs implied by them. Besides the syntax of path.Match,
+// a "**" segment matches zero or more segments.
+//
+// Patterns without "**" are matched level by level if the fs lists dirs, which lists the dirs matched so far
+// under the literal prefix of the segment only. Otherwise, the files under the longest literal prefix of the
+// pattern are listed, and matched while listing.
+func glob(ctx context.Context, l ListFS, pattern string) ([]string, error) {
+	segments := strings.Split(pattern, "/")
+	recursive := false
+	for _, seg := range segments {
+		if seg == "**" {
+			recursive = true
+		} else if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+	seen := make(map[string]bool) // a file may be a dir of others as well, e.g., a and a/b
+	var matches []string
+	var err error
+	if d, ok := l.(ListDirFS); ok && !recursive {
+		err = globDirs(ctx, d, segments, func(name string) {
+			if !seen[name] {
+				seen[name] = true
+				matches = append(matches, name)
+			}
+		})
+	} else {
+		err = l.List(ctx, literalPrefix(pattern), func(info fs.FileInfo) error {
+			names := strings.Split(info.Name(), "/")
+			for n := range names {
+				if !recursive && n+1 != len(segments) {
+					continue // only names of the same depth match
+				}
+				name := strings.Join(names[:n+1], "/")
+				if seen[name] {
+					continue // a dir of files listed already
+				}
+				seen[name] = true
+				if matchSegments(segments, names[:n+1]) {
+					matches = append(matches, name)
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(matches) // a/b.txt lists before a/b/c, while a/b sorts first
+	return matches, nil
+}
+
+// globDirs matches the segments level by level, the dirs of literal segments are not listed but the last one.
+func globDirs(ctx context.Context, d ListDirFS, segments []string, match func(name string)) error {
+	dirs := []string{""} // matched so far, with a trailing slash
+	for i, seg := range segments {
+		last := i+1 == len(segments)
+		var next []string
+		for _, dir := range dirs {
+			if !last && literalPrefix(seg) == seg {
+				next = append(next, dir+seg+"/")
+				continue
+			}
+			err := d.ListDir(ctx, dir+literalPrefix(seg), func(info fs.FileInfo) error {
+				name := info.Name()
+				if ok, _ := path.Match(seg, strings.TrimPrefix(name, dir)); !ok {
+					return nil
+				}
+				if last {
+					match(name)
+				} else if info.IsDir() && !slices.Contains(next, name+"/") {
+					next = append(next, name+"/")
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		dirs = next
+	}
+	return nil
+}
+
+// literalPrefix returns the pattern up to its first special character.
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// matchSegments reports whether the segments of a name match the ones of a valid pattern.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := range len(name) + 1 {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,131 @@
+package s3fs_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestGlob(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		prefixes []string
+	)
+	remote, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			mu.Lock()
+			if r.URL.Query().Get("delimiter") == "/" {
+				prefixes = append(prefixes, r.URL.Query().Get("prefix"))
+			}
+			mu.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	}))
+	defer done()
+	dir := t.TempDir()
+	local := s3fs.DirFS(dir)
+	ctx := context.TODO()
+	for _, name := range []string{
+		"logs/2026-09-30/part-0.gz",
+		"logs/2026-10-01/part-0.gz",
+		"logs/2026-10-01/part-1.gz",
+		"logs/2026-10-01/index.json",
+		"logs/2026-10-02/part-0.gz",
+		"logs/2026-10-02/sub/part-2.gz",
+		"logs/2026-10-02.txt",
+		"top.gz",
+	} {
+		for _, fsys := range []s3fs.FS{remote, local} {
+			if err := fsys.Put(ctx, name, strings.NewReader(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// listed level by level, only under the dirs matched
+	for _, tt := range []struct {
+		pattern  string
+		prefixes []string
+	}{
+		{"logs/2026-10-*/part-*.gz", []string{"logs/2026-10-", "logs/2026-10-01/part-", "logs/2026-10-02/part-"}},
+		{"logs/2026-10-0[12]", []string{"logs/2026-10-0"}},
+		{"logs/*", []string{"logs/"}},
+		{"*", []string{""}},
+		{"*/2026-10-01", []string{"", "logs/2026-10-01"}},
+		{"logs/2026-10-01/index.json", []string{"logs/2026-10-01/index.json"}},
+		{"logs/2026-10-01", []string{"logs/2026-10-01"}},
+		{"logs/2026-10-03/*", []string{"logs/2026-10-03/"}},
+	} {
+		want, err := fs.Glob(os.DirFS(dir), tt.pattern) // the semantic of fs.Glob
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fsys := range []s3fs.FS{remote, local} {
+			if got, err := fs.Glob(fsys, tt.pattern); err != nil || !slices.Equal(got, want) {
+				t.Fatalf("Glob(%q) of %T = %v, %v, want %v", tt.pattern, fsys, got, err, want)
+			}
+		}
+		mu.Lock()
+		if !slices.Equal(prefixes, tt.prefixes) {
+			t.Fatalf("Glob(%q) listed %q, want %q", tt.pattern, prefixes, tt.prefixes)
+		}
+		prefixes = nil
+		mu.Unlock()
+	}
+
+	for pattern, want := range map[string][]string{
+		"logs/**/part-*.gz": {
+			"logs/2026-09-30/part-0.gz",
+			"logs/2026-10-01/part-0.gz",
+			"logs/2026-10-01/part-1.gz",
+			"logs/2026-10-02/part-0.gz",
+			"logs/2026-10-02/sub/part-2.gz",
+		},
+		"**/sub": {"logs/2026-10-02/sub"},
+		"**/*.gz": {
+			"logs/2026-09-30/part-0.gz",
+			"logs/2026-10-01/part-0.gz",
+			"logs/2026-10-01/part-1.gz",
+			"logs/2026-10-02/part-0.gz",
+			"logs/2026-10-02/sub/part-2.gz",
+			"top.gz",
+		},
+	} {
+		for _, fsys := range []s3fs.FS{remote, local} {
+			got, err := fsys.(s3fs.ContextualGlobFS).GlobWithContext(ctx, pattern)
+			if err != nil || !slices.Equal(got, want) {
+				t.Fatalf("Glob(%q) of %T = %v, %v, want %v", pattern, fsys, got, err, want)
+			}
+		}
+	}
+
+	// a file which is a dir of others as well matches once
+	for _, name := range []string{"top.gz/part-0.gz", "top.gz/sub/part-1.gz"} {
+		if err := remote.Put(ctx, name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for pattern, want := range map[string][]string{
+		"top.*":    {"top.gz"},
+		"**/top.*": {"top.gz"},
+		"top.gz/*": {"top.gz/part-0.gz", "top.gz/sub"},
+	} {
+		got, err := remote.(s3fs.ContextualGlobFS).GlobWithContext(ctx, pattern)
+		if err != nil || !slices.Equal(got, want) {
+			t.Fatalf("Glob(%q) = %v, %v, want %v", pattern, got, err, want)
+		}
+	}
+
+	if _, err := fs.Glob(remote, "logs/[a-"); !errors.Is(err, path.ErrBadPattern) {
+		t.Fatalf("Glob() of bad pattern = %v, want %v", err, path.ErrBadPattern)
+	}
+}
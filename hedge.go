@@ -0,0 +1,164 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// HedgePolicy describes when a slow ranged GET is hedged by a duplicate request, see WithHedging.
+type HedgePolicy struct {
+	// Percentile of the latencies of recent ranged GETs to their first bytes, which a GET exceeding is hedged.
+	// Defaults to 0.95.
+	Percentile float64
+
+	// MinDelay is the lower bound of the latency to hedge, which is also the one until enough latencies are sampled.
+	// Defaults to 100ms.
+	MinDelay time.Duration
+}
+
+// WithHedging hedges the ranged GETs of chunks, i.e., up to WithBufferSize, which haven't returned the first bytes
+// within the percentile of the latencies of recent ones, by a duplicate request. The one finishing first is used,
+// while the other is canceled. The latencies are shared by the fs cloned by Namespace.
+//
+// Note it costs more requests, up to 1 - Percentile of them.
+func WithHedging(policy HedgePolicy) Option {
+	if policy.Percentile <= 0 || policy.Percentile >= 1 {
+		policy.Percentile = 0.95
+	}
+	if policy.MinDelay <= 0 {
+		policy.MinDelay = 100 * time.Millisecond
+	}
+	return func(fs *awsS3) {
+		fs.hedger = &hedger{policy: policy}
+	}
+}
+
+const (
+	// hedgeSamples is the number of the recent latencies the threshold is computed by.
+	hedgeSamples = 128
+	// minHedgeSamples is the number of latencies needed before using the percentile.
+	minHedgeSamples = 20
+)
+
+// hedger samples the latencies of ranged GETs, which is safe for concurrent use.
+type hedger struct {
+	policy HedgePolicy
+
+	mu        sync.Mutex
+	latencies []time.Duration // ring buffer
+	next      int
+}
+
+// observe samples the latency of a GET to its first bytes.
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeSamples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgeSamples
+}
+
+// threshold returns the latency after which a GET is hedged.
+func (h *hedger) threshold() time.Duration {
+	h.mu.Lock()
+	if len(h.latencies) < minHedgeSamples {
+		h.mu.Unlock()
+		return h.policy.MinDelay
+	}
+	latencies := slices.Clone(h.latencies)
+	h.mu.Unlock()
+	slices.Sort(latencies)
+	p := latencies[min(int(float64(len(latencies))*h.policy.Percentile), len(latencies)-1)]
+	return max(p, h.policy.MinDelay)
+}
+
+// hedged returns the client hedging the ranged GETs of chunks if WithHedging.
+func (c objectConfig) hedged(cli client) client {
+	if c.hedger == nil || c.bufLen <= 0 {
+		return cli
+	}
+	return &hedgedClient{client: cli, hedger: c.hedger, maxRange: c.bufLen, logger: c.logger}
+}
+
+// hedgedClient hedges the ranged GETs up to maxRange bytes, whose bodies are read in memory to race.
+type hedgedClient struct {
+	client
+	hedger   *hedger
+	maxRange int64
+	logger   *slog.Logger
+}
+
+// hedgedGet is the result of a GET of a race.
+type hedgedGet struct {
+	rsp *getObjectResponse
+	err error
+}
+
+func (c *hedgedClient) getObject(ctx context.Context, key string, offset, end int64, etag string) (*getObjectResponse, error) {
+	if offset < 0 || end < 0 || end-offset+1 > c.maxRange {
+		return c.client.getObject(ctx, key, offset, end, etag)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancels the loser
+	results := make(chan hedgedGet, 2)
+	firstBytes := make(chan struct{}, 2)
+	get := func() {
+		start := time.Now()
+		rsp, err := c.client.getObject(ctx, key, offset, end, etag)
+		if err == nil {
+			c.hedger.observe(time.Since(start))
+			firstBytes <- struct{}{}
+			rsp, err = readAll(rsp)
+		}
+		results <- hedgedGet{rsp: rsp, err: err}
+	}
+
+	go get()
+	timer := time.NewTimer(c.hedger.threshold())
+	defer timer.Stop()
+	pending := 1
+	var err error
+	for {
+		select {
+		case <-firstBytes:
+			timer.Stop() // the first GET is not slow, or the hedge has been sent
+		case <-timer.C:
+			logDebug(ctx, c.logger, "s3fs: hedging slow get", key, "offset", offset, "end", end)
+			pending++
+			go get()
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.rsp, nil
+			}
+			if err == nil {
+				err = r.err
+			}
+			if pending == 0 {
+				return nil, err // both failed, or the first failed before hedging, e.g., not found
+			}
+		}
+	}
+}
+
+// readAll reads the body of the response in memory.
+func readAll(rsp *getObjectResponse) (*getObjectResponse, error) {
+	defer func() { _ = rsp.body.Close() }()
+	var buf bytes.Buffer
+	if rsp.contentLength > 0 {
+		buf.Grow(int(rsp.contentLength))
+	}
+	if _, err := buf.ReadFrom(rsp.body); err != nil {
+		return nil, err
+	}
+	rsp.body = io.NopCloser(&buf)
+	return rsp, nil
+}
@@ -0,0 +1,73 @@
+package s3fs_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestHedging(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = make(map[string]int)
+		canceled = make(chan struct{})
+	)
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		rng := r.Header.Get("Range")
+		mu.Lock()
+		requests[rng]++
+		slow := rng == "bytes=4-7" && requests[rng] == 1
+		mu.Unlock()
+		if slow { // stalls until the hedge wins
+			select {
+			case <-r.Context().Done():
+				close(canceled)
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		next.ServeHTTP(w, r)
+	}), withOptions(
+		s3fs.WithBufferSize(4),
+		s3fs.WithHedging(s3fs.HedgePolicy{MinDelay: 50 * time.Millisecond}),
+	))
+	defer done()
+	const content = "hello, hedged world"
+	if err := fs.Put(context.TODO(), "file", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	f, err := fs.Open("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil || string(b) != content {
+		t.Fatalf("read %q, %v, want %q", b, err, content)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("read in %s, want the slow chunk hedged", d)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("the slow get should be canceled")
+	}
+	mu.Lock()
+	if requests["bytes=4-7"] != 2 || requests["bytes=0-3"] != 1 {
+		t.Fatalf("requests %v, want the slow chunk hedged only", requests)
+	}
+	mu.Unlock()
+
+	if _, err := fs.Open("missing"); err == nil {
+		t.Fatal("open missing file should fail")
+	}
+}
@@ -0,0 +1,97 @@
+package s3fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// WithLogger sets the logger of the debug logs of reading files, i.e., each GET request with its range and
+// Content-Range, fallbacks to whole downloads, resumed downloads and failures, the same for all backends.
+// Names of files are redacted into their short sha256 hashes, which correlate the lines of the same file.
+func WithLogger(logger *slog.Logger) Option {
+	return func(fs *awsS3) {
+		fs.logger = logger
+	}
+}
+
+// redactedKey is the name of a file, which is logged as its short hash.
+type redactedKey string
+
+// LogValue implements slog.LogValuer.
+func (k redactedKey) LogValue() slog.Value {
+	sum := sha256.Sum256([]byte(k))
+	return slog.StringValue(hex.EncodeToString(sum[:6]))
+}
+
+// redact replaces the name in s, e.g., the message of an error, with its hash.
+func (k redactedKey) redact(s string) string {
+	if k == "" {
+		return s
+	}
+	hash := k.LogValue().String()
+	s = strings.ReplaceAll(s, string(k), hash)
+	return strings.ReplaceAll(s, strings.ReplaceAll(url.PathEscape(string(k)), "%2F", "/"), hash) // in urls
+}
+
+// logDebug logs the message of the file at debug level, if the logger is set.
+// The name is redacted, also from the errors of args.
+func logDebug(ctx context.Context, logger *slog.Logger, msg, name string, args ...any) {
+	if logger == nil || !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	key := redactedKey(name)
+	for i, arg := range args {
+		if err, ok := arg.(error); ok {
+			args[i] = key.redact(err.Error())
+		}
+	}
+	logger.DebugContext(ctx, msg, append([]any{slog.Any("key", key)}, args...)...)
+}
+
+// debug logs the message of the file at debug level, if the logger is set.
+func (c objectConfig) debug(ctx context.Context, msg, name string, args ...any) {
+	logDebug(ctx, c.logger, msg, name, args...)
+}
+
+// logged returns the client logging its requests if the logger is set.
+func (c objectConfig) logged(cli client) client {
+	if c.logger == nil {
+		return cli
+	}
+	return &loggedClient{client: cli, logger: c.logger}
+}
+
+// loggedClient logs each request of the client.
+type loggedClient struct {
+	client
+	logger *slog.Logger
+}
+
+func (c *loggedClient) getObject(ctx context.Context, key string, offset, end int64, etag string) (*getObjectResponse, error) {
+	start := time.Now()
+	rsp, err := c.client.getObject(ctx, key, offset, end, etag)
+	args := []any{"namespace", c.namespace(), "offset", offset, "end", end, "ifMatch", etag != ""}
+	if err != nil {
+		logDebug(ctx, c.logger, "s3fs: get failed", key, append(args, "duration", time.Since(start), "error", err)...)
+		return nil, err
+	}
+	logDebug(ctx, c.logger, "s3fs: get", key, append(args, "contentRange", aws.ToString(rsp.contentRange),
+		"contentLength", rsp.contentLength, "duration", time.Since(start))...)
+	return rsp, nil
+}
+
+func (c *loggedClient) headObject(ctx context.Context, key, ifNoneMatch string) (*objectInfo, error) {
+	info, err := c.client.headObject(ctx, key, ifNoneMatch)
+	if err != nil && !errors.Is(err, errNotModified) {
+		logDebug(ctx, c.logger, "s3fs: stat failed", key, "namespace", c.namespace(), "error", err)
+	}
+	return info, err
+}
@@ -0,0 +1,52 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	fs, done := newTestFs(withOptions(
+		s3fs.WithBufferSize(4),
+		s3fs.WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	))
+	defer done()
+	const name = "secret/report.csv"
+	ctx := context.TODO()
+	if err := fs.Put(ctx, name, strings.NewReader("hello, world")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := fs.Open("secret/missing.csv"); err == nil {
+		t.Fatal("open missing file should fail")
+	}
+
+	out := logs.String()
+	for _, want := range []string{
+		`msg="s3fs: get" key=`,
+		`offset=4 end=7 ifMatch=false contentRange="bytes 4-7/12"`,
+		`msg="s3fs: falling back to whole download"`,
+		`msg="s3fs: get failed"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("logs miss %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Fatalf("logs reveal the names of files:\n%s", out)
+	}
+}
@@ -7,12 +7,19 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 var (
@@ -21,27 +28,145 @@ var (
 	_ io.Seeker   = (*object)(nil)
 )
 
+// objectConfig holds the settings shared by every object opened from a fs.
+type objectConfig struct {
+	bufLen int64
+
+	// resume decides how a download broken halfway is resumed.
+	resume *RetryPolicy
+	// timeout is the deadline of each operation, zero means no deadline.
+	timeout time.Duration
+
+	chunkCache *ChunkCache
+	// readAhead is the number of chunks fetched in background ahead of reading.
+	readAhead int
+	// sse is the default server side encryption, nil means the default of the bucket or container.
+	sse *SSE
+	// checksum is the algorithm of integrity checks, empty means off.
+	checksum ChecksumAlgorithm
+	// bandwidth limits the bytes transferred, nil means unlimited.
+	bandwidth *limiter
+	// observer is notified of the operations, nil means none.
+	observer Observer
+	// logger logs the requests of objects at debug level, nil means none.
+	logger *slog.Logger
+	// hedger hedges slow ranged GETs of chunks, nil means never.
+	hedger *hedger
+
+	transfer
+}
+
+// newObject creates the object of the name, the caller must call obj.cancel when done.
+func (c objectConfig) newObject(ctx context.Context, cli client, name string) *object {
+	ctx, cancel := context.WithCancel(ctx)
+	return &object{
+		ctx:          ctx,
+		cancel:       cancel,
+		client:       cli,
+		buf:          new(bytes.Buffer),
+		objectConfig: c,
+		name:         name,
+		tracker:      c.track(OpRead, name, -1),
+	}
+}
+
+// openObject opens the object of the name, which recycles its buffer on Close.
+func (c objectConfig) openObject(ctx context.Context, cli client, name string) (fs.File, error) {
+	ctx, done := observe(ctx, c.observer, &Operation{Op: OpOpen, Namespace: cli.namespace(), Key: name, Offset: -1, End: -1})
+	obj := c.newObject(ctx, cli, name)
+	obj.buf = bufPool.Get().(*bytes.Buffer)
+	if err := obj.fillChunk(false); err != nil { // first chunk contains metadata
+		_ = obj.Close()
+		done(0, err)
+		return nil, err
+	}
+	done(int64(obj.buf.Len()), nil)
+	return obj, nil
+}
+
+// readRange reads length bytes of the object from offset by a ranged get, or up to the end if length is negative.
+func (c objectConfig) readRange(ctx context.Context, cli client, name string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	end := int64(-1)
+	switch {
+	case length > 0:
+		end = offset + length - 1
+	case offset == 0:
+		offset = -1 // the whole object, ranged gets of empty objects fail
+	}
+	t := c.track(OpRead, name, length)
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	rsp, err := cli.getObject(ctx, name, offset, end, "")
+	if err != nil {
+		cancel()
+		return nil, notFoundError("read", name, err)
+	}
+	t.setTotal(rsp.contentLength)
+	body := t.readCloser(rsp.body)
+	if c.bandwidth != nil {
+		body = struct {
+			io.Reader
+			io.Closer
+		}{c.bandwidth.reader(ctx, body), body}
+	}
+	return &rangeReader{ReadCloser: body, cancel: cancel}, nil
+}
+
+// rangeReader releases the timeout of the request on Close.
+type rangeReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer.
+func (r *rangeReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// bufPool recycles the buffers of closed objects.
+var bufPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// maxPooledBufLen is the max capacity of buffers going back to bufPool, larger ones are left to GC.
+const maxPooledBufLen = 8 << 20
+
 // object represents a s3 object which implements fs.File.
 type object struct {
-	ctx context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	client client
 
-	buf    bytes.Buffer
-	bufLen int64
+	buf *bytes.Buffer
+	objectConfig
+
+	tracker *tracker
 
 	name     string
 	dlOffset int64 // dl offset, downloaded bytes offset.
 	size     int64
 	modTime  time.Time
+	etag     string
 
 	rOffset int // read offset
 
 	completelyLoaded bool
+	closed           bool
+
+	prefetchCtx     context.Context
+	stopPrefetching context.CancelFunc
+	prefetches      []*prefetch // in order of offset
 }
 
 // Seek implements io.Seeker.
 func (obj *object) Seek(offset int64, whence int) (int64, error) {
+	if obj.closed {
+		return 0, &fs.PathError{Op: "seek", Path: obj.name, Err: fs.ErrClosed}
+	}
 	var newOffset int64
 	switch whence {
 	case io.SeekStart:
@@ -56,16 +181,36 @@ func (obj *object) Seek(offset int64, whence int) (int64, error) {
 	if newOffset < 0 {
 		return 0, errors.New("s3fs.object.Seek: negative position")
 	}
+	if newOffset > obj.dlOffset && !obj.completelyLoaded {
+		obj.stopPrefetch() // the rest will be downloaded at once
+	}
 
 	obj.rOffset = int(newOffset)
 	return newOffset, nil
 }
 
-// Close implements fs.File.
-func (o *object) Close() error { return nil }
+// Close implements fs.File, it cancels the in-flight requests and releases the buffer.
+// Read and Seek fail with fs.ErrClosed after Close, while calling Close again is a no-op.
+func (o *object) Close() error {
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	o.stopPrefetch()
+	o.cancel()
+	if o.buf.Cap() <= maxPooledBufLen {
+		o.buf.Reset()
+		bufPool.Put(o.buf)
+	}
+	o.buf = nil
+	return nil
+}
 
 // Read implements fs.File.
 func (obj *object) Read(b []byte) (int, error) {
+	if obj.closed {
+		return 0, &fs.PathError{Op: "read", Path: obj.name, Err: fs.ErrClosed}
+	}
 	if obj.rOffset >= int(obj.size) {
 		return 0, io.EOF
 	}
@@ -110,77 +255,312 @@ func (o *object) Size() int64 { return o.size }
 // Sys implements fs.FileInfo.
 func (o *object) Sys() any { return nil }
 
+// ETag implements ETagger.
+func (o *object) ETag() string { return o.etag }
+
+// objectInfo is the fs.FileInfo of an object got without its content.
+type objectInfo struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	etag     string
+	metadata Metadata
+
+	checksumAlgorithm ChecksumAlgorithm
+	checksum          string
+}
+
+// IsDir implements fs.FileInfo.
+func (o *objectInfo) IsDir() bool { return false }
+
+// ModTime implements fs.FileInfo.
+func (o *objectInfo) ModTime() time.Time { return o.modTime }
+
+// Mode implements fs.FileInfo.
+func (o *objectInfo) Mode() fs.FileMode { return fs.ModePerm }
+
+// Name implements fs.FileInfo.
+func (o *objectInfo) Name() string { return o.name }
+
+// Size implements fs.FileInfo.
+func (o *objectInfo) Size() int64 { return o.size }
+
+// Sys implements fs.FileInfo.
+func (o *objectInfo) Sys() any { return nil }
+
+// ETag implements ETagger.
+func (o *objectInfo) ETag() string { return o.etag }
+
+// Metadata implements MetadataInfo.
+func (o *objectInfo) Metadata() Metadata { return o.metadata }
+
+// Checksum implements Checksummer.
+func (o *objectInfo) Checksum() (ChecksumAlgorithm, string) { return o.checksumAlgorithm, o.checksum }
+
+// dirInfo is the fs.FileInfo of a dir implied by the names of objects.
+type dirInfo struct{ name string }
+
+// IsDir implements fs.FileInfo.
+func (d *dirInfo) IsDir() bool { return true }
+
+// ModTime implements fs.FileInfo.
+func (d *dirInfo) ModTime() time.Time { return time.Time{} }
+
+// Mode implements fs.FileInfo.
+func (d *dirInfo) Mode() fs.FileMode { return fs.ModeDir | fs.ModePerm }
+
+// Name implements fs.FileInfo.
+func (d *dirInfo) Name() string { return d.name }
+
+// Size implements fs.FileInfo.
+func (d *dirInfo) Size() int64 { return 0 }
+
+// Sys implements fs.FileInfo.
+func (d *dirInfo) Sys() any { return nil }
+
+// errNotModified is returned by headObject if the object has the ETag of ifNoneMatch.
+var errNotModified = errors.New("s3fs: not modified")
+
+// headError converts the error of headObject, i.e., errNotModified if not modified, or like notFoundError.
+func headError(name string, err error) error {
+	if httpStatusCode(err) == http.StatusNotModified {
+		return errNotModified
+	}
+	return notFoundError("stat", name, err)
+}
+
+// notFoundError converts the not found error of the op to fs.ErrNotExist.
+func notFoundError(op, name string, err error) error {
+	if httpStatusCode(err) == http.StatusNotFound {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return err
+}
+
 type blobClient struct {
 	container string
 	blob      *azblob.Client
+	sse       *SSE
+	checksum  ChecksumAlgorithm
 }
 
-func (b *blobClient) getObject(ctx context.Context, key string, offset, count int64) (*getObjectResponse, error) {
-	var _range blob.HTTPRange
+func (b *blobClient) getObject(ctx context.Context, key string, offset, end int64, etag string) (*getObjectResponse, error) {
+	var opts blob.DownloadStreamOptions
 	if offset > -1 {
-		_range = blob.HTTPRange{
-			Offset: offset,
-			Count:  count,
+		opts.Range.Offset = offset
+		if end > -1 {
+			opts.Range.Count = end - offset + 1
+		}
+	}
+	if etag != "" {
+		opts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: to.Ptr(azcore.ETag(etag))},
 		}
 	}
-	rsp, err := b.blob.DownloadStream(ctx, b.container, key, &blob.DownloadStreamOptions{
-		Range: _range,
-	})
+	sse, err := sseFrom(ctx, b.sse)
+	if err != nil {
+		return nil, err
+	}
+	opts.CPKInfo, opts.CPKScopeInfo = sse.cpkInfo(), sse.cpkScopeInfo()
+	rsp, err := b.blob.DownloadStream(ctx, b.container, key, &opts)
 	if err != nil {
 		return nil, err
 	}
 	ret := &getObjectResponse{
 		body:          rsp.Body,
-		contentLength: *rsp.ContentLength,
+		contentLength: -1, // unknown
 		contentRange:  rsp.ContentRange,
-		lastModified:  *rsp.LastModified,
+		lastModified:  aws.ToTime(rsp.LastModified),
+	}
+	if rsp.ContentLength != nil {
+		ret.contentLength = *rsp.ContentLength
+	}
+	if rsp.ETag != nil {
+		ret.etag = string(*rsp.ETag)
+	}
+	if offset < 0 {
+		ret.checksumAlgorithm, ret.checksum = azureChecksum(rsp.ContentMD5)
+	} else {
+		ret.checksumAlgorithm, ret.checksum = azureChecksum(rsp.BlobContentMD5)
 	}
 	return ret, nil
 }
 
-func newS3Client(s3 *s3.Client, bucket string) client {
+func (b *blobClient) headObject(ctx context.Context, key, ifNoneMatch string) (*objectInfo, error) {
+	sse, err := sseFrom(ctx, b.sse)
+	if err != nil {
+		return nil, err
+	}
+	opts := &blob.GetPropertiesOptions{CPKInfo: sse.cpkInfo()}
+	if ifNoneMatch != "" {
+		opts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: to.Ptr(azcore.ETag(ifNoneMatch))},
+		}
+	}
+	rsp, err := b.blob.ServiceClient().NewContainerClient(b.container).NewBlobClient(key).GetProperties(ctx, opts)
+	if err != nil {
+		return nil, headError(key, err)
+	}
+	info := &objectInfo{
+		name:    key,
+		size:    *rsp.ContentLength,
+		modTime: *rsp.LastModified,
+		metadata: Metadata{
+			ContentType:     aws.ToString(rsp.ContentType),
+			ContentEncoding: aws.ToString(rsp.ContentEncoding),
+		},
+	}
+	if rsp.ETag != nil {
+		info.etag = string(*rsp.ETag)
+	}
+	info.checksumAlgorithm, info.checksum = azureChecksum(rsp.ContentMD5)
+	for k, v := range rsp.Metadata {
+		if info.metadata.User == nil {
+			info.metadata.User = make(map[string]string, len(rsp.Metadata))
+		}
+		info.metadata.User[strings.ToLower(k)] = aws.ToString(v)
+	}
+	return info, nil
+}
+
+func (b *blobClient) namespace() string { return b.container }
+
+func (b *blobClient) location() string {
+	endpoint, _, _ := strings.Cut(b.blob.URL(), "?")
+	return strings.TrimSuffix(endpoint, "/") + "/" + b.container
+}
+
+func newS3Client(s3 *s3.Client, bucket string, sse *SSE, checksum ChecksumAlgorithm) client {
 	return &s3Client{
-		bucket: bucket,
-		s3:     s3,
+		bucket:   bucket,
+		s3:       s3,
+		sse:      sse,
+		checksum: checksum,
 	}
 }
 
-func newBlobClient(blob *azblob.Client, container string) client {
+func newBlobClient(blob *azblob.Client, container string, sse *SSE, checksum ChecksumAlgorithm) client {
 	return &blobClient{
 		container: container,
 		blob:      blob,
+		sse:       sse,
+		checksum:  checksum,
 	}
 }
 
 type s3Client struct {
-	bucket string
-	s3     *s3.Client
+	bucket   string
+	s3       *s3.Client
+	sse      *SSE
+	checksum ChecksumAlgorithm
 }
 
-func (s *s3Client) getObject(ctx context.Context, key string, offset, count int64) (*getObjectResponse, error) {
+func (s *s3Client) getObject(ctx context.Context, key string, offset, end int64, etag string) (*getObjectResponse, error) {
 	var _range *string
-	if offset > -1 {
-		_range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, count))
+	switch {
+	case offset > -1 && end > -1:
+		_range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, end))
+	case offset > -1:
+		_range = aws.String(fmt.Sprintf("bytes=%d-", offset))
 	}
-	rsp, err := s.s3.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-		Range:  _range,
-	})
+	var ifMatch *string
+	if etag != "" {
+		ifMatch = aws.String(etag)
+	}
+	sse, err := sseFrom(ctx, s.sse)
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.GetObjectInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(key),
+		Range:   _range,
+		IfMatch: ifMatch,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.customer()
+	if s.checksum != "" {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+	rsp, err := s.s3.GetObject(ctx, input)
 	if err != nil {
 		return nil, err
 	}
 	ret := &getObjectResponse{
 		body:          rsp.Body,
-		contentLength: *rsp.ContentLength,
+		contentLength: -1, // unknown
 		contentRange:  rsp.ContentRange,
-		lastModified:  *rsp.LastModified,
+		lastModified:  aws.ToTime(rsp.LastModified),
+		etag:          aws.ToString(rsp.ETag),
 	}
+	if rsp.ContentLength != nil {
+		ret.contentLength = *rsp.ContentLength
+	}
+	ret.checksumAlgorithm, ret.checksum = s3Checksum(rsp.ChecksumType,
+		rsp.ChecksumCRC32, rsp.ChecksumCRC32C, rsp.ChecksumCRC64NVME, rsp.ChecksumSHA1, rsp.ChecksumSHA256)
 	return ret, nil
 }
 
+func (s *s3Client) headObject(ctx context.Context, key, ifNoneMatch string) (*objectInfo, error) {
+	sse, err := sseFrom(ctx, s.sse)
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.customer()
+	if s.checksum != "" {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+	if ifNoneMatch != "" {
+		input.IfNoneMatch = aws.String(ifNoneMatch)
+	}
+	rsp, err := s.s3.HeadObject(ctx, input)
+	if err != nil {
+		return nil, headError(key, err)
+	}
+	info := &objectInfo{
+		name:    key,
+		size:    aws.ToInt64(rsp.ContentLength),
+		modTime: aws.ToTime(rsp.LastModified),
+		etag:    aws.ToString(rsp.ETag),
+		metadata: Metadata{
+			ContentType:     aws.ToString(rsp.ContentType),
+			ContentEncoding: aws.ToString(rsp.ContentEncoding),
+			User:            rsp.Metadata, // lower cased by the sdk
+		},
+	}
+	info.checksumAlgorithm, info.checksum = s3Checksum(rsp.ChecksumType,
+		rsp.ChecksumCRC32, rsp.ChecksumCRC32C, rsp.ChecksumCRC64NVME, rsp.ChecksumSHA1, rsp.ChecksumSHA256)
+	return info, nil
+}
+
+func (s *s3Client) namespace() string { return s.bucket }
+
+func (s *s3Client) location() string {
+	endpoint := aws.ToString(s.s3.Options().BaseEndpoint)
+	if endpoint == "" {
+		endpoint = "s3." + s.s3.Options().Region + ".amazonaws.com"
+	}
+	return endpoint + "/" + s.bucket
+}
+
 type client interface {
-	getObject(ctx context.Context, key string, offset, count int64) (*getObjectResponse, error)
+	// getObject gets the bytes [offset, end] of the object, both inclusive.
+	// A negative offset means the whole object, a negative end means up to the last byte.
+	// If etag is not empty, the request fails unless the object still has the given etag.
+	getObject(ctx context.Context, key string, offset, end int64, etag string) (*getObjectResponse, error)
+
+	// headObject gets the metadata of the object, or fs.ErrNotExist if not found.
+	// It returns errNotModified if the ETag of the object is ifNoneMatch, if any.
+	headObject(ctx context.Context, key, ifNoneMatch string) (*objectInfo, error)
+
+	// namespace is the bucket or container.
+	namespace() string
+
+	// location identifies the bucket or container, i.e., <endpoint>/<namespace>.
+	location() string
 }
 
 type getObjectResponse struct {
@@ -188,19 +568,35 @@ type getObjectResponse struct {
 	contentLength int64
 	contentRange  *string
 	lastModified  time.Time
+	etag          string
+
+	// checksum is the base64 checksum of the whole object if known.
+	checksumAlgorithm ChecksumAlgorithm
+	checksum          string
 }
 
 // dl downloads all the bytes, this is a fallback of fillChunk.
 func (obj *object) dl() error {
-	rsp, err := obj.client.getObject(obj.ctx, obj.name, -1, 0)
+	ctx, cancel := withTimeout(obj.ctx, obj.timeout)
+	defer cancel()
+	rsp, err := obj.client.getObject(ctx, obj.name, -1, -1, "")
 	if err != nil {
 		return err
 	}
 	defer func() { _ = rsp.body.Close() }()
-	return obj.parseFullResponse(rsp)
+	if err := obj.parseFullResponse(ctx, rsp); err != nil {
+		return err
+	}
+	if obj.checksum != "" {
+		if err := verifyChecksum(obj.name, obj.buf.Bytes(), rsp.checksumAlgorithm, rsp.checksum); err != nil {
+			obj.debug(ctx, "s3fs: checksum mismatch", obj.name, "algorithm", rsp.checksumAlgorithm)
+			return err
+		}
+	}
+	return nil
 }
 
-func (obj *object) parseFullResponse(rsp *getObjectResponse) error {
+func (obj *object) parseFullResponse(ctx context.Context, rsp *getObjectResponse) error {
 	switch {
 	default:
 		fallthrough
@@ -209,56 +605,273 @@ func (obj *object) parseFullResponse(rsp *getObjectResponse) error {
 	case !obj.modTime.Equal(rsp.lastModified):
 		return fmt.Errorf("Last-Modified changed, before %s, now %s", obj.modTime, rsp.lastModified)
 	}
+	if rsp.contentLength < 0 {
+		return errors.New("s3fs: missing Content-Length")
+	}
+	obj.tracker.setTotal(rsp.contentLength)
 
-	if _, err := io.Copy(&obj.buf, rsp.body); err != nil {
+	if err := obj.copyBody(ctx, obj.buf, rsp, 0, rsp.contentLength-1, true); err != nil {
 		return err
 	}
 
+	obj.etag = rsp.etag
 	obj.size = rsp.contentLength
 	obj.completelyLoaded = true
 	return nil
 }
 
+// copyBody appends rsp.body, i.e., the bytes [offset, end] of the object, to dst.
+//
+// If the stream breaks halfway, the remaining bytes are requested again with a ranged GET
+// conditioned on the ETag, so the object can't change underneath us.
+// If it finally fails, dst is restored so no partial bytes are left behind.
+// The bytes are charged to the tracker and bandwidth of obj as copied if metered.
+func (obj *object) copyBody(ctx context.Context, dst *bytes.Buffer, rsp *getObjectResponse, offset, end int64, metered bool) error {
+	n0 := dst.Len()
+	body := rsp.body
+	for retry := 0; ; retry++ {
+		var r io.Reader = body
+		if metered {
+			r = obj.bandwidth.reader(ctx, obj.tracker.reader(body))
+		}
+		n, err := io.Copy(dst, r)
+		if body != rsp.body {
+			_ = body.Close()
+		}
+		offset += n
+		if err == nil || offset > end {
+			return nil
+		}
+		if !obj.resumable(retry, rsp, err) || ctx.Err() != nil {
+			obj.debug(ctx, "s3fs: download broken", obj.name, "offset", offset, "end", end, "retry", retry, "error", err)
+			dst.Truncate(n0)
+			return err
+		}
+		obj.debug(ctx, "s3fs: resuming broken download", obj.name, "offset", offset, "end", end, "retry", retry, "error", err)
+		if err := sleep(ctx, obj.resume.delay(retry)); err != nil {
+			dst.Truncate(n0)
+			return err
+		}
+		next, err := obj.client.getObject(ctx, obj.name, offset, end, rsp.etag)
+		if err != nil {
+			dst.Truncate(n0)
+			return fmt.Errorf("resume %s from byte %d: %w", obj.name, offset, err)
+		}
+		body = next.body
+	}
+}
+
+// resumable reports whether the download broken by err can be resumed.
+func (obj *object) resumable(retry int, rsp *getObjectResponse, err error) bool {
+	switch {
+	case obj.resume == nil, rsp.etag == "", retry >= obj.resume.retries():
+		return false
+	case obj.resume.Retryable != nil:
+		return obj.resume.Retryable(0, err)
+	}
+	return true
+}
+
+// sleep pauses for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 // fillChunk downloads next chunk of bytes from s3 for obj.
 func (obj *object) fillChunk(full bool) error {
 	if obj.bufLen == 0 {
 		return obj.dl()
 	}
+	if !full && obj.dlOffset > 0 && obj.etag != "" && (obj.chunkCache != nil || obj.readAhead > 0) {
+		if err := obj.fillNextChunk(); err != nil {
+			return err
+		}
+		obj.readAheadChunks()
+		return nil
+	}
 	end := obj.dlOffset + obj.bufLen - 1
 	if full {
+		obj.stopPrefetch()
 		end = obj.size - 1
 	}
-	rsp, err := obj.client.getObject(obj.ctx, obj.name, obj.dlOffset, end)
+	ctx, cancel := withTimeout(obj.ctx, obj.timeout)
+	defer cancel()
+	rsp, err := obj.client.getObject(ctx, obj.name, obj.dlOffset, end, "")
 	if err != nil {
 		// If it's the first try got HTTP 416, then fallback get.
 		// It's rare. This only happens when the file is empty, i.e. zero bytes file.
 		if obj.dlOffset == 0 {
+			obj.debug(ctx, "s3fs: falling back to whole download", obj.name, "end", end, "error", err)
 			return obj.dl()
 		}
 		return err
 	}
 	defer func() { _ = rsp.body.Close() }() // body is never nil, the cos code is ugly.
 
-	return obj.parsePartialResponse(rsp)
+	if err := obj.parsePartialResponse(ctx, rsp); err != nil {
+		return err
+	}
+	obj.readAheadChunks()
+	return nil
 }
 
-func (obj *object) parsePartialResponse(rsp *getObjectResponse) error {
+func (obj *object) parsePartialResponse(ctx context.Context, rsp *getObjectResponse) error {
 	obj.modTime = rsp.lastModified
-	if _, err := io.Copy(&obj.buf, rsp.body); err != nil {
+	start, end, size, ok := parseContentRange(rsp.contentRange)
+	if !ok {
+		return fmt.Errorf("parse content-range: %v", rsp.contentRange)
+	}
+	obj.tracker.setTotal(size)
+
+	if err := obj.copyBody(ctx, obj.buf, rsp, start, end, true); err != nil {
 		return err
 	}
 
-	_, end, size, ok := parseContentRange(rsp.contentRange)
-	if !ok {
-		return fmt.Errorf("parse content-range: %v", rsp.contentRange)
+	if obj.chunkCache != nil && start == 0 && end == obj.bufLen-1 && rsp.etag != "" {
+		obj.chunkCache.add(obj.chunkKey(rsp.etag, 0), bytes.Clone(obj.buf.Bytes()[:end+1]))
 	}
 
+	obj.etag = rsp.etag
 	obj.size = size
 	obj.dlOffset = end + 1               // http range is inclusive
 	obj.completelyLoaded = end == size-1 // range offset starts as 0
 	return nil
 }
 
+func (obj *object) chunkKey(etag string, index int64) chunkKey {
+	return chunkKey{
+		location: obj.client.location(),
+		name:     obj.name,
+		etag:     etag,
+		bufLen:   obj.bufLen,
+		index:    index,
+	}
+}
+
+// fillNextChunk fills the next chunk of the same version of the first one, i.e., it has the same ETag,
+// from the read-ahead chunks or the chunk cache if any.
+func (obj *object) fillNextChunk() error {
+	offset := obj.dlOffset
+	end := min(offset+obj.bufLen, obj.size) - 1
+	var chunk []byte
+	var err error
+	if len(obj.prefetches) > 0 && obj.prefetches[0].offset == offset {
+		p := obj.prefetches[0]
+		obj.prefetches = obj.prefetches[1:]
+		select {
+		case <-obj.ctx.Done():
+			return obj.ctx.Err()
+		case <-p.done:
+			chunk, err = p.data, p.err
+		}
+		if err != nil { // try again in the foreground
+			obj.debug(obj.ctx, "s3fs: read-ahead chunk failed", obj.name, "offset", offset, "end", end, "error", err)
+			chunk, err = obj.fetchChunk(obj.ctx, obj.etag, offset, end)
+		}
+	} else {
+		obj.stopPrefetch()
+		chunk, err = obj.fetchChunk(obj.ctx, obj.etag, offset, end)
+	}
+	if err != nil {
+		return err
+	}
+	if int64(len(chunk)) != end-offset+1 {
+		return fmt.Errorf("s3fs: chunk [%d, %d] of %s got %d bytes", offset, end, obj.name, len(chunk))
+	}
+	obj.buf.Write(chunk)
+	obj.dlOffset = end + 1
+	obj.completelyLoaded = end == obj.size-1
+	return nil
+}
+
+// fetchChunk downloads the bytes [offset, end] of the object version etag, through the chunk cache if any.
+// It's safe to be called in background, since it doesn't touch obj's mutable state.
+//
+// A fetch of the chunk cache is shared by the readers waiting for it, so it's charged to the tracker and
+// bandwidth of each of them once received, rather than to the reader starting it.
+func (obj *object) fetchChunk(ctx context.Context, etag string, offset, end int64) ([]byte, error) {
+	metered := obj.chunkCache == nil
+	fetch := func(ctx context.Context) ([]byte, error) {
+		ctx, cancel := withTimeout(ctx, obj.timeout)
+		defer cancel()
+		rsp, err := obj.client.getObject(ctx, obj.name, offset, end, etag)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rsp.body.Close() }()
+		var buf bytes.Buffer
+		buf.Grow(int(end - offset + 1))
+		if err := obj.copyBody(ctx, &buf, rsp, offset, end, metered); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if obj.chunkCache == nil {
+		return fetch(ctx)
+	}
+	chunk, fetched, err := obj.chunkCache.get(ctx, obj.chunkKey(etag, offset/obj.bufLen), fetch)
+	if err != nil || !fetched {
+		return chunk, err
+	}
+	obj.tracker.add(int64(len(chunk)), 0)
+	if err := obj.bandwidth.wait(ctx, int64(len(chunk))); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// prefetch is a chunk being fetched in background.
+type prefetch struct {
+	offset, end int64
+
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// readAheadChunks keeps the next obj.readAhead chunks being fetched in background.
+func (obj *object) readAheadChunks() {
+	if obj.readAhead <= 0 || obj.completelyLoaded || obj.etag == "" {
+		return
+	}
+	if obj.stopPrefetching == nil {
+		obj.prefetchCtx, obj.stopPrefetching = context.WithCancel(obj.ctx)
+	}
+	next := obj.dlOffset
+	if n := len(obj.prefetches); n > 0 {
+		next = obj.prefetches[n-1].end + 1
+	}
+	for len(obj.prefetches) < obj.readAhead && next < obj.size {
+		p := &prefetch{
+			offset: next,
+			end:    min(next+obj.bufLen, obj.size) - 1,
+			done:   make(chan struct{}),
+		}
+		go func(ctx context.Context, etag string) {
+			defer close(p.done)
+			p.data, p.err = obj.fetchChunk(ctx, etag, p.offset, p.end)
+		}(obj.prefetchCtx, obj.etag)
+		obj.prefetches = append(obj.prefetches, p)
+		next = p.end + 1
+	}
+}
+
+// stopPrefetch cancels the chunks being fetched in background.
+func (obj *object) stopPrefetch() {
+	if obj.stopPrefetching != nil {
+		obj.stopPrefetching()
+		obj.prefetchCtx, obj.stopPrefetching = nil, nil
+	}
+	obj.prefetches = nil
+}
+
 func parseContentRange(s *string) (start, end, total int64, ok bool) {
 	if s == nil {
 		ok = false
@@ -0,0 +1,164 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/longkai/s3fs"
+)
+
+// flakyClient breaks the body of the first `breaks` GET responses after `after` bytes.
+type flakyClient struct {
+	http   *awshttp.BuildableClient
+	breaks atomic.Int32
+	after  int
+}
+
+func (c *flakyClient) Do(req *http.Request) (*http.Response, error) {
+	rsp, err := c.http.Do(req)
+	if err != nil || req.Method != http.MethodGet || rsp.StatusCode >= 300 {
+		return rsp, err
+	}
+	if c.breaks.Add(-1) >= 0 {
+		rsp.Body = &brokenBody{ReadCloser: rsp.Body, left: c.after}
+	}
+	return rsp, err
+}
+
+type brokenBody struct {
+	io.ReadCloser
+	left int
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		return 0, errors.New("connection reset by peer")
+	}
+	if len(p) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= n
+	return n, err
+}
+
+func newFlakyFs(t *testing.T, cli *flakyClient, options ...s3fs.Option) s3fs.FS {
+	t.Helper()
+	cli.http = awshttp.NewBuildableClient()
+	fs, done := newTestFs(withOptions(append([]s3fs.Option{s3fs.WithBufferSize(0)}, options...)...),
+		withOptFns(func(o *s3.Options) { o.HTTPClient = cli }))
+	t.Cleanup(done)
+	return fs
+}
+
+func TestResumeBrokenStream(t *testing.T) {
+	var buf bytes.Buffer
+	for i := range 1000 {
+		fmt.Fprintf(&buf, "this is line %d\n", i)
+	}
+	content := buf.String()
+
+	for _, bufLen := range []int64{0, 4096} {
+		cli := &flakyClient{after: 1000}
+		fs := newFlakyFs(t, cli, s3fs.WithBufferSize(bufLen), s3fs.WithResume(3, time.Millisecond))
+		if err := fs.Put(context.TODO(), "large", bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+
+		cli.breaks.Store(3)
+		b, err := fs.ReadFile("large")
+		if err != nil {
+			t.Fatalf("bufLen %d: ReadFile: %+v", bufLen, err)
+		}
+		if string(b) != content {
+			t.Fatalf("bufLen %d: ReadFile got %d bytes, want %d", bufLen, len(b), len(content))
+		}
+
+		cli.breaks.Store(3)
+		f, err := fs.Open("large")
+		if err != nil {
+			t.Fatalf("bufLen %d: Open: %+v", bufLen, err)
+		}
+		b, err = io.ReadAll(f)
+		if err != nil {
+			t.Fatalf("bufLen %d: ReadAll: %+v", bufLen, err)
+		}
+		if string(b) != content {
+			t.Fatalf("bufLen %d: ReadAll got %d bytes, want %d", bufLen, len(b), len(content))
+		}
+	}
+}
+
+func TestResumeGiveUp(t *testing.T) {
+	cli := &flakyClient{after: 10}
+	fs := newFlakyFs(t, cli, s3fs.WithResume(1, time.Millisecond))
+	if err := fs.Put(context.TODO(), "key", bytes.NewReader(make([]byte, 100))); err != nil {
+		t.Fatal(err)
+	}
+	cli.breaks.Store(2)
+	if _, err := fs.ReadFile("key"); err == nil {
+		t.Fatal("ReadFile should fail after retries exhausted")
+	}
+}
+
+func TestClose(t *testing.T) {
+	var blocked, cancelled atomic.Int32
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if r.Method == http.MethodGet && strings.HasPrefix(r.Header.Get("Range"), "bytes=") &&
+			!strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+			// hang the chunks read ahead until cancelled
+			blocked.Add(1)
+			<-r.Context().Done()
+			cancelled.Add(1)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), withOptions(
+		s3fs.WithBufferSize(10),
+		s3fs.WithReadAhead(2),
+		s3fs.WithRetry(s3fs.RetryPolicy{MaxAttempts: 1}),
+	))
+	defer done()
+
+	if err := fs.Put(context.TODO(), "key", bytes.NewReader(make([]byte, 100))); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.Open("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); blocked.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); cancelled.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if got := cancelled.Load(); got != 2 {
+		t.Fatalf("got %d read-ahead requests cancelled by Close, want 2", got)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close again: %+v", err)
+	}
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, iofs.ErrClosed) {
+		t.Fatalf("Read after Close = %v, want fs.ErrClosed", err)
+	}
+	if _, err := f.(io.Seeker).Seek(0, io.SeekStart); !errors.Is(err, iofs.ErrClosed) {
+		t.Fatalf("Seek after Close = %v, want fs.ErrClosed", err)
+	}
+}
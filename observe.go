@@ -0,0 +1,236 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// The ops of Operation, besides OpPut.
+const (
+	// OpOpen opens a file, including the GET of its first chunk.
+	OpOpen = "open"
+	// OpGet is each GET request of a file, e.g., a chunk, a range or the whole file.
+	OpGet = "get"
+	// OpPutPart uploads a part of a Put or PutResumable.
+	OpPutPart = "put_part"
+	OpStat    = "stat"
+	OpDelete  = "delete"
+	OpList    = "list"
+	OpPresign = "presign"
+)
+
+// Operation is an operation of a fs reported to the Observer.
+type Operation struct {
+	// Op is the name of the operation, e.g., OpGet.
+	Op string
+	// Namespace is the bucket or container.
+	Namespace string
+	// Key is the name of the file, or the prefix of OpList.
+	Key string
+	// Offset and End are the byte range of OpGet, both inclusive, negative ones mean the whole file or up to the end.
+	Offset, End int64
+	// Part is the number of OpPutPart.
+	Part int32
+
+	// The results set before End.
+
+	// Bytes is the number of bytes transferred.
+	Bytes int64
+	// Status is the HTTP status code of the failed operation, zero if succeeded or no response at all.
+	Status   int
+	Err      error
+	Duration time.Duration
+}
+
+// Observer is notified of the start and the end of each operation of a fs, e.g., for tracing and metrics.
+// It must be safe for concurrent use.
+type Observer interface {
+	// Start is called before the operation, the returned ctx is used by the operation and passed to End.
+	Start(ctx context.Context, op *Operation) context.Context
+
+	// End is called after the operation, with its results.
+	End(ctx context.Context, op *Operation)
+}
+
+// WithObserver sets the observer of the operations of aws s3 or azure blob, which is shared by the fs cloned by Namespace.
+//
+// Note the blocks of Put of azure blob are reported in the order of starting, rather than their offsets.
+func WithObserver(observer Observer) Option {
+	return func(fs *awsS3) {
+		fs.observer = observer
+	}
+}
+
+// observe starts the operation, the returned end reports it with the bytes transferred and the error.
+func observe(ctx context.Context, observer Observer, op *Operation) (context.Context, func(bytes int64, err error)) {
+	if observer == nil {
+		return ctx, func(int64, error) {}
+	}
+	start := time.Now()
+	ctx = observer.Start(ctx, op)
+	return ctx, func(bytes int64, err error) {
+		op.Bytes, op.Err, op.Duration = bytes, err, time.Since(start)
+		if op.Status == 0 {
+			op.Status = httpStatusCode(err)
+		}
+		if op.Status == 0 && errors.Is(err, fs.ErrNotExist) {
+			op.Status = http.StatusNotFound // converted by notFoundError
+		}
+		observer.End(ctx, op)
+	}
+}
+
+// observed returns the client observed by the observer if any.
+func (c objectConfig) observed(cli client) client {
+	if c.observer == nil {
+		return cli
+	}
+	return &observedClient{client: cli, observer: c.observer}
+}
+
+// observedClient reports each request of the client.
+type observedClient struct {
+	client
+	observer Observer
+}
+
+func (c *observedClient) getObject(ctx context.Context, key string, offset, end int64, etag string) (*getObjectResponse, error) {
+	ctx, done := observe(ctx, c.observer, &Operation{Op: OpGet, Namespace: c.namespace(), Key: key, Offset: offset, End: end})
+	rsp, err := c.client.getObject(ctx, key, offset, end, etag)
+	if err != nil {
+		done(0, err)
+		return nil, err
+	}
+	rsp.body = &observedBody{ReadCloser: rsp.body, done: done}
+	return rsp, nil
+}
+
+func (c *observedClient) headObject(ctx context.Context, key, ifNoneMatch string) (*objectInfo, error) {
+	ctx, done := observe(ctx, c.observer, &Operation{Op: OpStat, Namespace: c.namespace(), Key: key})
+	info, err := c.client.headObject(ctx, key, ifNoneMatch)
+	if errors.Is(err, errNotModified) {
+		done(0, nil)
+	} else {
+		done(0, err)
+	}
+	return info, err
+}
+
+// observedBody ends the get on Close, which lasts until the body is read.
+type observedBody struct {
+	io.ReadCloser
+	done  func(bytes int64, err error)
+	bytes int64
+	err   error
+	once  sync.Once
+}
+
+// Read implements io.Reader.
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *observedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.bytes, b.err) })
+	return err
+}
+
+// partObserver observes the parts of an upload, which are numbered in order of starting if not numbered.
+type partObserver struct {
+	observer Observer
+	put      *Operation
+	parts    atomic.Int32
+}
+
+type partObserverKey struct{}
+
+// observeParts lets the parts of the put in the ctx be observed.
+func (c objectConfig) observeParts(ctx context.Context, put *Operation) context.Context {
+	if c.observer == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, partObserverKey{}, &partObserver{observer: c.observer, put: put})
+}
+
+// observePart starts the part of the put in the ctx if any, number zero numbers it in order.
+// The returned ctx observes no more parts, e.g., the requests of the part.
+func observePart(ctx context.Context, number int32, size int64) (context.Context, func(err error)) {
+	p, _ := ctx.Value(partObserverKey{}).(*partObserver)
+	if p == nil {
+		return ctx, func(error) {}
+	}
+	if number == 0 {
+		number = p.parts.Add(1)
+	}
+	ctx = context.WithValue(ctx, partObserverKey{}, (*partObserver)(nil))
+	ctx, done := observe(ctx, p.observer, &Operation{Op: OpPutPart, Namespace: p.put.Namespace, Key: p.put.Key, Part: number})
+	return ctx, func(err error) { done(size, err) }
+}
+
+// awsPartObserver observes the parts uploaded by the s3 upload manager.
+func awsPartObserver(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("s3fsPartObserver",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+			middleware.InitializeOutput, middleware.Metadata, error,
+		) {
+			input, ok := in.Parameters.(*s3.UploadPartInput)
+			if !ok {
+				return next.HandleInitialize(ctx, in)
+			}
+			ctx, done := observePart(ctx, aws.ToInt32(input.PartNumber), bodySize(input.Body))
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			done(err)
+			return out, metadata, err
+		}), middleware.After)
+}
+
+// azurePartObserver is a policy observing the blocks staged by UploadStream of azure blob.
+type azurePartObserver struct{}
+
+// Do implements policy.Policy.
+func (azurePartObserver) Do(req *policy.Request) (*http.Response, error) {
+	raw := req.Raw()
+	if raw.URL.Query().Get("comp") != "block" {
+		return req.Next()
+	}
+	if p, _ := raw.Context().Value(partObserverKey{}).(*partObserver); p == nil {
+		return req.Next() // not observed, or observed by the caller already
+	}
+	ctx, done := observePart(raw.Context(), 0, raw.ContentLength)
+	req = req.WithContext(ctx)
+	rsp, err := req.Next()
+	if err == nil && rsp.StatusCode >= 400 {
+		done(&statusError{status: rsp.StatusCode})
+	} else {
+		done(err)
+	}
+	return rsp, err
+}
+
+// statusError is the failed status of a response, before the sdk converts it into an error.
+type statusError struct {
+	status int
+}
+
+func (e *statusError) Error() string { return http.StatusText(e.status) }
+
+// HTTPStatusCode reports the status to httpStatusCode.
+func (e *statusError) HTTPStatusCode() int { return e.status }
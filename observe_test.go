@@ -0,0 +1,113 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+// recorder records the operations ended.
+type recorder struct {
+	mu  sync.Mutex
+	ops []s3fs.Operation
+}
+
+func (r *recorder) Start(ctx context.Context, op *s3fs.Operation) context.Context { return ctx }
+
+func (r *recorder) End(ctx context.Context, op *s3fs.Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, *op)
+}
+
+// take returns the operations recorded so far of the op.
+func (r *recorder) take(op string) []s3fs.Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ops []s3fs.Operation
+	r.ops = slices.DeleteFunc(r.ops, func(o s3fs.Operation) bool {
+		if o.Op == op {
+			ops = append(ops, o)
+		}
+		return o.Op == op
+	})
+	return ops
+}
+
+func TestObserver(t *testing.T) {
+	rec := &recorder{}
+	fsys, done := newTestFs(withOptions(
+		s3fs.WithBufferSize(4<<20),
+		s3fs.WithUploadPartSize(5<<20),
+		s3fs.WithObserver(rec),
+	))
+	defer done()
+	ctx := context.TODO()
+	content := bytes.Repeat([]byte("0123456789abcdef"), (11<<20)/16)
+	size := int64(len(content))
+
+	if err := fsys.Put(ctx, "big", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if puts := rec.take(s3fs.OpPut); len(puts) != 1 || puts[0].Bytes != size || puts[0].Namespace != "test-bucket" {
+		t.Fatalf("put ops %+v, want one of %d bytes", puts, size)
+	}
+	var parts []int32
+	for _, p := range rec.take(s3fs.OpPutPart) {
+		if p.Key != "big" || p.Err != nil || p.Bytes <= 0 {
+			t.Fatalf("put part %+v", p)
+		}
+		parts = append(parts, p.Part)
+	}
+	if slices.Sort(parts); !slices.Equal(parts, []int32{1, 2, 3}) {
+		t.Fatalf("put parts %v, want [1 2 3]", parts)
+	}
+
+	f, err := fsys.Open("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if opens := rec.take(s3fs.OpOpen); len(opens) != 1 || opens[0].Bytes != 4<<20 {
+		t.Fatalf("open ops %+v, want one with the first chunk", opens)
+	}
+	gets := rec.take(s3fs.OpGet)
+	var got int64
+	for _, g := range gets {
+		got += g.Bytes
+	}
+	if len(gets) != 3 || got != size || gets[1].Offset != 4<<20 || gets[1].End != 8<<20-1 {
+		t.Fatalf("get ops %+v, want 3 chunks of %d bytes", gets, size)
+	}
+
+	if _, err := fsys.(s3fs.ContextualStatFS).StatWithContext(ctx, "missing"); err == nil {
+		t.Fatal("stat missing file should fail")
+	}
+	if stats := rec.take(s3fs.OpStat); len(stats) != 1 || stats[0].Status != http.StatusNotFound || stats[0].Err == nil {
+		t.Fatalf("stat ops %+v, want a 404", stats)
+	}
+	if err := fsys.(s3fs.ListFS).List(ctx, "b", func(fs.FileInfo) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.(s3fs.PresignFS).PresignGet(ctx, "big"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Delete(ctx, "big"); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []string{s3fs.OpList, s3fs.OpPresign, s3fs.OpDelete} {
+		if ops := rec.take(op); len(ops) != 1 || ops[0].Err != nil || ops[0].Duration <= 0 {
+			t.Fatalf("%s ops %+v, want one succeeded", op, ops)
+		}
+	}
+}
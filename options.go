@@ -1,6 +1,10 @@
 package s3fs
 
 import (
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
@@ -19,6 +23,81 @@ func WithCredential(ak, sk string) Option {
 	}
 }
 
+// WithSessionToken sets the session token of the temporary credential set by WithCredential, aws s3 only.
+func WithSessionToken(token string) Option {
+	return func(fs *awsS3) {
+		fs.token = token
+	}
+}
+
+// WithCredentialsProvider sets the aws credentials provider, which takes precedence over WithCredential, aws s3 only.
+// e.g., aws.AnonymousCredentials{} for public buckets, or a stscreds.AssumeRoleProvider.
+//
+// If neither is set, credentials are resolved by the aws default chain: env vars, shared config and credentials files,
+// web identity token file, ECS container and EC2 instance metadata.
+func WithCredentialsProvider(provider aws.CredentialsProvider) Option {
+	return func(fs *awsS3) {
+		fs.credsProvider = provider
+	}
+}
+
+// WithAzureConnectionString sets the endpoint and the credential of azure blob by the storage connection string, e.g.,
+//   - DefaultEndpointsProtocol=https;AccountName=<account>;AccountKey=<key>;EndpointSuffix=core.windows.net
+//   - BlobEndpoint=https://<account>.blob.core.windows.net/;SharedAccessSignature=<sas-token>
+//   - UseDevelopmentStorage=true, i.e., Azurite at http://127.0.0.1:10000/devstoreaccount1
+//
+// It also selects the azure blob backend.
+func WithAzureConnectionString(connStr string) Option {
+	return func(fs *awsS3) {
+		fs.azConnStr = connStr
+		fs.backend = BackendAzBlob
+	}
+}
+
+// WithAzureTokenCredential sets the azure blob credential, e.g., any one from the azidentity package.
+func WithAzureTokenCredential(cred azcore.TokenCredential) Option {
+	return func(fs *awsS3) {
+		fs.azCredential = func() (azcore.TokenCredential, error) { return cred, nil }
+	}
+}
+
+// WithAzureClientSecret authenticates azure blob as a service principal with the client secret.
+func WithAzureClientSecret(tenantID, clientID, secret string) Option {
+	return func(fs *awsS3) {
+		fs.azCredential = func() (azcore.TokenCredential, error) {
+			return azidentity.NewClientSecretCredential(tenantID, clientID, secret, nil)
+		}
+	}
+}
+
+// WithAzureClientCertificate authenticates azure blob as a service principal with the certificate,
+// certData is the PEM or PKCS12 encoded certificate and private key, password is empty if not encrypted.
+func WithAzureClientCertificate(tenantID, clientID string, certData []byte, password string) Option {
+	return func(fs *awsS3) {
+		fs.azCredential = func() (azcore.TokenCredential, error) {
+			certs, key, err := azidentity.ParseCertificates(certData, []byte(password))
+			if err != nil {
+				return nil, err
+			}
+			return azidentity.NewClientCertificateCredential(tenantID, clientID, certs, key, nil)
+		}
+	}
+}
+
+// WithAzureWorkloadIdentity authenticates azure blob by the workload identity federation, e.g., on kubernetes.
+// Empty arguments default to the AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_FEDERATED_TOKEN_FILE envs.
+func WithAzureWorkloadIdentity(tenantID, clientID, tokenFile string) Option {
+	return func(fs *awsS3) {
+		fs.azCredential = func() (azcore.TokenCredential, error) {
+			return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+				TenantID:      tenantID,
+				ClientID:      clientID,
+				TokenFilePath: tokenFile,
+			})
+		}
+	}
+}
+
 // WithRegion sets the region.
 func WithRegion(region string) Option {
 	return func(fs *awsS3) {
@@ -62,3 +141,57 @@ func WithOptFns(optFns ...func(*s3.Options)) Option {
 		fs.optFns = optFns
 	}
 }
+
+// WithResume sets how many times a download broken halfway is resumed from the last received byte,
+// waiting backoff before the first retry and doubling it after each one.
+// It overrides WithRetry for resuming only. Defaults to 3 retries with 100ms backoff, zero retries disables resuming.
+func WithResume(retries int, backoff time.Duration) Option {
+	return func(fs *awsS3) {
+		fs.resume = &RetryPolicy{
+			MaxAttempts: retries + 1,
+			BaseDelay:   backoff,
+		}
+	}
+}
+
+// WithRetry sets the retry policy for both aws s3 and azure blob requests, as well as resuming broken downloads.
+//
+// Note options set by WithOptFns take precedence for aws s3.
+func WithRetry(policy RetryPolicy) Option {
+	return func(fs *awsS3) {
+		fs.retry = &policy
+		fs.timeout = policy.Timeout
+	}
+}
+
+// WithReadAhead sets the number of chunks fetched in background ahead of reading, it needs a non-zero WithBufferSize.
+// Defaults to zero, i.e., fetching the next chunk only when it's read.
+func WithReadAhead(chunks int) Option {
+	return func(fs *awsS3) {
+		fs.readAhead = chunks
+	}
+}
+
+// WithUploadPartSize sets the size of each part of multipart uploads, or each block of azure blob.
+// Defaults to the sdk ones, i.e., 5MiB for aws s3 and 1MiB for azure blob, 4MiB for resumable uploads of azure blob.
+// It's raised for files which need more parts than the service allows.
+func WithUploadPartSize(size int64) Option {
+	return func(fs *awsS3) {
+		fs.partSize = size
+	}
+}
+
+// WithUploadConcurrency sets the number of parts uploaded in parallel, defaults to 5 for aws s3 and 1 for azure blob.
+func WithUploadConcurrency(n int) Option {
+	return func(fs *awsS3) {
+		fs.concurrency = n
+	}
+}
+
+// WithLeavePartsOnError keeps the parts uploaded when a multipart upload of aws s3 fails, instead of aborting it.
+// Note the parts are charged until aborted, e.g., by the lifecycle rules of the bucket.
+func WithLeavePartsOnError() Option {
+	return func(fs *awsS3) {
+		fs.leavePartsOnError = true
+	}
+}
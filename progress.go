@@ -0,0 +1,239 @@
+package s3fs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// The ops of Progress.
+const (
+	OpPut  = "put"
+	OpRead = "read"
+)
+
+// Progress is an event of the transfer of a file, reported to the callback set by WithProgress.
+type Progress struct {
+	// Op is OpPut for uploads, or OpRead for downloads.
+	Op   string
+	Name string
+	// Bytes is the number of bytes of the file transferred so far.
+	Bytes int64
+	// Total is the size of the file, or -1 if unknown, e.g., puts from streams.
+	Total int64
+	// Part is the number of the part just uploaded of uploads by parts, or zero for events of bytes.
+	Part int32
+}
+
+// WithProgress sets the callback of the progress of uploads and downloads, i.e., Put, PutResumable, ReadFile,
+// ReadRange and reading opened files. It's called in the goroutines transferring the bytes, possibly concurrently,
+// thus it should be fast and safe for concurrent use.
+//
+// Note bytes of uploads are reported as read from the reader, which the sdk buffers before sending, but Put of
+// aws s3 reports the bytes of each request or part once sent.
+func WithProgress(fn func(Progress)) Option {
+	return func(fs *awsS3) {
+		fs.progress = fn
+	}
+}
+
+// Stats are the cumulative counters of the transfers of a fs, shared by the fs cloned by Namespace.
+type Stats struct {
+	BytesUploaded   int64
+	BytesDownloaded int64
+	// Uploads is the number of files put, including failed ones.
+	Uploads int64
+	// Downloads is the number of files opened or read, including failed ones.
+	Downloads int64
+}
+
+// StatsFS reports the cumulative counters of the fs.
+type StatsFS interface {
+	// Stats returns the counters so far.
+	Stats() Stats
+}
+
+// counters are the atomic Stats.
+type counters struct {
+	bytesUploaded, bytesDownloaded atomic.Int64
+	uploads, downloads             atomic.Int64
+}
+
+// transfer holds the settings of the progress and the counters of a fs.
+type transfer struct {
+	progress func(Progress)
+	counters *counters
+}
+
+// Stats implements StatsFS.
+func (t transfer) Stats() Stats {
+	if t.counters == nil {
+		return Stats{}
+	}
+	return Stats{
+		BytesUploaded:   t.counters.bytesUploaded.Load(),
+		BytesDownloaded: t.counters.bytesDownloaded.Load(),
+		Uploads:         t.counters.uploads.Load(),
+		Downloads:       t.counters.downloads.Load(),
+	}
+}
+
+// readerSize returns the size of the content left in the reader to put, or -1 if unknown.
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Len() int }: // e.g., bytes.Buffer, bytes.Reader and strings.Reader
+		return int64(r.Len())
+	case fs.File:
+		if info, err := r.Stat(); err == nil && info.Mode().IsRegular() {
+			if s, ok := r.(io.Seeker); ok {
+				if offset, err := s.Seek(0, io.SeekCurrent); err == nil {
+					return info.Size() - offset
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// track starts tracking the transfer of the file, total is -1 if unknown.
+// It returns nil if neither progress nor counters are set, whose methods are no-ops.
+func (t transfer) track(op, name string, total int64) *tracker {
+	if t.progress == nil && t.counters == nil {
+		return nil
+	}
+	tr := &tracker{transfer: t, op: op, name: name}
+	tr.total.Store(total)
+	if t.counters != nil {
+		if op == OpPut {
+			t.counters.uploads.Add(1)
+		} else {
+			t.counters.downloads.Add(1)
+		}
+	}
+	return tr
+}
+
+// tracker tracks the transfer of a file, which is safe for concurrent use.
+type tracker struct {
+	transfer
+	op, name string
+	bytes    atomic.Int64
+	total    atomic.Int64
+}
+
+// add counts n bytes transferred of the part, zero for events of bytes.
+func (t *tracker) add(n int64, part int32) {
+	if t == nil || (n == 0 && part == 0) {
+		return
+	}
+	if t.counters != nil {
+		if t.op == OpPut {
+			t.counters.bytesUploaded.Add(n)
+		} else {
+			t.counters.bytesDownloaded.Add(n)
+		}
+	}
+	bytes := t.bytes.Add(n)
+	if t.progress != nil {
+		t.progress(Progress{Op: t.op, Name: t.name, Bytes: bytes, Total: t.total.Load(), Part: part})
+	}
+}
+
+// transferred returns the number of bytes transferred so far.
+func (t *tracker) transferred() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.bytes.Load()
+}
+
+// setTotal sets the size of the file once known.
+func (t *tracker) setTotal(total int64) {
+	if t != nil {
+		t.total.Store(total)
+	}
+}
+
+// reader counts the bytes read from r.
+func (t *tracker) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &trackedReader{r: r, t: t}
+}
+
+type trackedReader struct {
+	r io.Reader
+	t *tracker
+}
+
+// Read implements io.Reader.
+func (r *trackedReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.t.add(int64(n), 0)
+	return n, err
+}
+
+// readCloser counts the bytes read from rc.
+func (t *tracker) readCloser(rc io.ReadCloser) io.ReadCloser {
+	if t == nil {
+		return rc
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{t.reader(rc), rc}
+}
+
+// s3Uploads counts the bytes of each request or part sent by the s3 upload manager, rather than wrapping the reader
+// put, which would hide io.Seeker and io.ReaderAt the manager reads parts without copying and retries them by.
+func (t *tracker) s3Uploads(o *s3.Options) {
+	if t == nil {
+		return
+	}
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("s3fsProgress",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				middleware.InitializeOutput, middleware.Metadata, error,
+			) {
+				var body io.Reader
+				var part int32
+				switch input := in.Parameters.(type) {
+				case *s3.PutObjectInput:
+					body = input.Body
+				case *s3.UploadPartInput:
+					body, part = input.Body, aws.ToInt32(input.PartNumber)
+				default:
+					return next.HandleInitialize(ctx, in)
+				}
+				size := bodySize(body)
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if err == nil {
+					t.add(max(size, 0), part)
+				}
+				return out, metadata, err
+			}), middleware.After)
+	})
+}
+
+// bodySize returns the size of the body of a request left to send, or -1 if unknown.
+func bodySize(body io.Reader) int64 {
+	s, ok := body.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	offset, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if _, serr := s.Seek(offset, io.SeekStart); err != nil || serr != nil {
+		return -1
+	}
+	return end - offset
+}
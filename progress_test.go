@@ -0,0 +1,106 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestProgress(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []s3fs.Progress
+	)
+	fs, done := newTestFs(withOptions(
+		s3fs.WithBufferSize(1<<20),
+		s3fs.WithUploadPartSize(5<<20),
+		s3fs.WithProgress(func(p s3fs.Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, p)
+		}),
+	))
+	defer done()
+	content := bytes.Repeat([]byte("0123456789abcdef"), (11<<20)/16)
+	size := int64(len(content))
+	ctx := context.TODO()
+	body := &readerAtRecorder{Reader: bytes.NewReader(content)}
+	if err := fs.Put(ctx, "big", body); err != nil {
+		t.Fatal(err)
+	}
+	if body.readAt.Load() == 0 {
+		t.Fatal("put without ReadAt, want parts read from the reader as is")
+	}
+	var parts []int32
+	for _, e := range events {
+		if e.Op != s3fs.OpPut || e.Name != "big" || e.Total != size {
+			t.Fatalf("put event %+v, want total %d", e, size)
+		}
+		if e.Part > 0 {
+			parts = append(parts, e.Part)
+		}
+	}
+	slices.Sort(parts)
+	if last := events[len(events)-1]; last.Bytes != size || !slices.Equal(parts, []int32{1, 2, 3}) {
+		t.Fatalf("put %d bytes of parts %v, want %d bytes of parts [1 2 3]", last.Bytes, parts, size)
+	}
+
+	events = nil
+	f, err := fs.Open("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if last := events[len(events)-1]; last.Op != s3fs.OpRead || last.Bytes != size || last.Total != size {
+		t.Fatalf("read event %+v, want %d bytes", last, size)
+	}
+
+	other := fs.Namespace("other-bucket")
+	if err := other.Put(ctx, "small", bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	want := s3fs.Stats{BytesUploaded: size + 5, BytesDownloaded: size, Uploads: 2, Downloads: 1}
+	if got := fs.(s3fs.StatsFS).Stats(); got != want {
+		t.Fatalf("stats %+v, want %+v shared by namespaces", got, want)
+	}
+}
+
+// readerAtRecorder records the calls of ReadAt, by which the upload manager reads parts without copying.
+type readerAtRecorder struct {
+	*bytes.Reader
+	readAt atomic.Int32
+}
+
+func (r *readerAtRecorder) ReadAt(b []byte, off int64) (int, error) {
+	r.readAt.Add(1)
+	return r.Reader.ReadAt(b, off)
+}
+
+func TestDirProgress(t *testing.T) {
+	var last s3fs.Progress
+	fs := s3fs.DirFS(t.TempDir(), s3fs.WithProgress(func(p s3fs.Progress) { last = p }))
+	if err := fs.Put(context.TODO(), "a", bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if want := (s3fs.Progress{Op: s3fs.OpPut, Name: "a", Bytes: 5, Total: 5}); last != want {
+		t.Fatalf("put event %+v, want %+v", last, want)
+	}
+	if _, err := fs.ReadFile("a"); err != nil {
+		t.Fatal(err)
+	}
+	if want := (s3fs.Progress{Op: s3fs.OpRead, Name: "a", Bytes: 5, Total: 5}); last != want {
+		t.Fatalf("read event %+v, want %+v", last, want)
+	}
+	if got, want := fs.(s3fs.StatsFS).Stats(), (s3fs.Stats{BytesUploaded: 5, BytesDownloaded: 5, Uploads: 1, Downloads: 1}); got != want {
+		t.Fatalf("stats %+v, want %+v", got, want)
+	}
+}
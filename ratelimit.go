@@ -0,0 +1,136 @@
+package s3fs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// WithRateLimit limits the bandwidth of the fs to bytesPerSec, both uploads and downloads of files count, including
+// chunks fetched in background by WithReadAhead. It's shared by the fs cloned by Namespace.
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(fs *awsS3) {
+		fs.bandwidth = newLimiter(float64(bytesPerSec), bytesPerSec)
+	}
+}
+
+// WithRequestLimit limits the requests sent by the fs to rps per second with bursts of up to burst requests,
+// retries included, e.g., to avoid 503 SlowDown of aws s3 on hot prefixes. It's shared by the fs cloned by Namespace.
+//
+// Note the limit of aws s3 is lost if WithOptFns replaces the APIOptions.
+func WithRequestLimit(rps float64, burst int) Option {
+	return func(fs *awsS3) {
+		fs.requests = newLimiter(rps, int64(max(burst, 1)))
+	}
+}
+
+// limiter is a token bucket safe for concurrent use, nil means unlimited.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait takes n tokens, blocking until they are refilled unless ctx is done first.
+// It takes more tokens than the burst at once, which are paid back before the next wait returns.
+func (l *limiter) wait(ctx context.Context, n int64) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	debt := l.tokens
+	l.mu.Unlock()
+	if debt >= 0 {
+		return nil
+	}
+	return sleep(ctx, time.Duration(-debt/l.rate*float64(time.Second)))
+}
+
+// reader limits the bytes read from r.
+func (l *limiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l}
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *limiter
+}
+
+// Read implements io.Reader, the bytes read are paid after reading.
+func (r *limitedReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if werr := r.l.wait(r.ctx, int64(n)); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+// awsAPIOption waits for a token before sending each request of aws s3.
+func (l *limiter) awsAPIOption(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("s3fsRequestLimit",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (
+			middleware.FinalizeOutput, middleware.Metadata, error,
+		) {
+			if err := l.wait(ctx, 1); err != nil {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+			}
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After) // after the retry middleware, thus retries wait too
+}
+
+// s3Uploads waits for the tokens of the body of each request or part sent by the s3 upload manager, rather than
+// limiting the reader put, which would hide io.Seeker and io.ReaderAt from the manager.
+func (l *limiter) s3Uploads(o *s3.Options) {
+	if l == nil {
+		return
+	}
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("s3fsBandwidth",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				middleware.InitializeOutput, middleware.Metadata, error,
+			) {
+				var body io.Reader
+				switch input := in.Parameters.(type) {
+				case *s3.PutObjectInput:
+					body = input.Body
+				case *s3.UploadPartInput:
+					body = input.Body
+				}
+				if err := l.wait(ctx, bodySize(body)); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, err
+				}
+				return next.HandleInitialize(ctx, in)
+			}), middleware.After)
+	})
+}
+
+// Do implements policy.Policy, which waits for a token before sending each request of azure blob.
+func (l *limiter) Do(req *policy.Request) (*http.Response, error) {
+	if err := l.wait(req.Raw().Context(), 1); err != nil {
+		return nil, err
+	}
+	return req.Next()
+}
@@ -0,0 +1,51 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestRateLimit(t *testing.T) {
+	fs, done := newTestFs(withOptions(
+		s3fs.WithBufferSize(0),
+		s3fs.WithRateLimit(32<<10),
+		s3fs.WithRequestLimit(10, 1),
+	))
+	defer done()
+	ctx := context.TODO()
+	elapsed := func(fn func() error) time.Duration {
+		t.Helper()
+		start := time.Now()
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start)
+	}
+
+	// the burst of 32KiB goes at once, the rest 16KiB takes 0.5s, either for uploads or downloads.
+	content := bytes.Repeat([]byte("x"), 48<<10)
+	if d := elapsed(func() error { return fs.Put(ctx, "file", bytes.NewReader(content)) }); d < 400*time.Millisecond {
+		t.Fatalf("put 48KiB at 32KiB/s in %s", d)
+	}
+	if d := elapsed(func() error { _, err := fs.ReadFile("file"); return err }); d < 400*time.Millisecond {
+		t.Fatalf("read 48KiB at 32KiB/s in %s", d)
+	}
+
+	// namespaces share the limits, 5 requests at 10/s take 0.4s at least after the first one.
+	other := fs.Namespace("other-bucket").(s3fs.ContextualStatFS)
+	d := elapsed(func() error {
+		for range 5 {
+			if _, err := other.StatWithContext(ctx, "file"); err == nil {
+				t.Fatal("stat should fail in the other bucket")
+			}
+		}
+		return nil
+	})
+	if d < 350*time.Millisecond {
+		t.Fatalf("sent 5 requests at 10/s in %s", d)
+	}
+}
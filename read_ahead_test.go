@@ -0,0 +1,65 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestReadAhead(t *testing.T) {
+	var gets atomic.Int32
+	fs, done := newTestFs(countGets(&gets), withOptions(s3fs.WithBufferSize(100), s3fs.WithReadAhead(3)))
+	defer done()
+	content := bytes.Repeat([]byte("0123456789"), 100) // 10 chunks
+	if err := fs.Put(context.TODO(), "key", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	gets.Store(0)
+	f, err := fs.Open("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// the first chunk, then 3 chunks ahead without reading
+	for deadline := time.Now().Add(time.Second); gets.Load() < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if got := gets.Load(); got != 4 {
+		t.Fatalf("got %d GETs after open, want 4", got)
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Fatalf("read %d bytes, want %d", len(b), len(content))
+	}
+	if got := gets.Load(); got != 10 {
+		t.Fatalf("got %d GETs after reading all, want 10", got)
+	}
+
+	// seek beyond the read-ahead chunks
+	f2, err := fs.Open("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	if _, err := f2.(io.Seeker).Seek(950, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content[950:]) {
+		t.Fatalf("read after seek %q, want %q", b, content[950:])
+	}
+}
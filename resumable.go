@@ -0,0 +1,239 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+)
+
+// uploadConfig holds the settings of uploads by parts.
+type uploadConfig struct {
+	// partSize is the size of each part or block, zero means the default of the sdk.
+	partSize int64
+	// concurrency is the number of parts uploaded in parallel, zero means the default of the sdk.
+	concurrency int
+	// leavePartsOnError keeps the parts uploaded of a failed multipart upload of aws s3.
+	leavePartsOnError bool
+}
+
+// partSizeFor returns the part size of the resumable upload of size, which is raised to keep the parts within limit.
+func (c uploadConfig) partSizeFor(size, defaultSize, maxParts int64) int64 {
+	partSize := c.partSize
+	if partSize <= 0 {
+		partSize = defaultSize
+	}
+	return max(partSize, (size+maxParts-1)/maxParts)
+}
+
+// checkpoint is the progress of a resumable upload persisted in json.
+type checkpoint struct {
+	Location string           `json:"location"`
+	Name     string           `json:"name"`
+	Size     int64            `json:"size"`
+	PartSize int64            `json:"partSize"`
+	UploadID string           `json:"uploadId,omitempty"`
+	Parts    []checkpointPart `json:"parts"`
+}
+
+// checkpointPart is an uploaded part, numbered from 1.
+type checkpointPart struct {
+	Number   int32  `json:"number"`
+	ETag     string `json:"etag,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// loadCheckpoint loads the checkpoint of the upload from the file, or starts a new one if not found.
+// A checkpoint of another upload, e.g., of a different size, is discarded.
+//
+// The file is a json line of the checkpoint followed by a json line of each part uploaded after it's saved,
+// a last line torn by crashes is ignored.
+func loadCheckpoint(path, location, name string, size, partSize int64) (*checkpoint, error) {
+	cp := &checkpoint{Location: location, Name: name, Size: size, PartSize: partSize}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	line, b, _ := bytes.Cut(b, []byte("\n"))
+	var saved checkpoint
+	if err := json.Unmarshal(line, &saved); err != nil {
+		return nil, fmt.Errorf("s3fs: malformed checkpoint %s: %w", path, err)
+	}
+	for len(b) > 0 {
+		var ok bool
+		if line, b, ok = bytes.Cut(b, []byte("\n")); !ok {
+			break // torn
+		}
+		var part checkpointPart
+		if err := json.Unmarshal(line, &part); err != nil {
+			return nil, fmt.Errorf("s3fs: malformed checkpoint %s: %w", path, err)
+		}
+		saved.Parts = append(saved.Parts, part)
+	}
+	if saved.Location != location || saved.Name != name || saved.Size != size || saved.PartSize <= 0 {
+		return cp, nil
+	}
+	return &saved, nil
+}
+
+// save writes the checkpoint to a temp file then renames it, so that it's never partially written.
+func (cp *checkpoint) save(path string) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", append(b, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// appendPart appends the part uploaded to the checkpoint file saved, rather than saving all the parts again.
+func appendPart(f *os.File, part checkpointPart) error {
+	b, err := json.Marshal(part)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// parts returns the number of parts, an empty file has one empty part.
+func (cp *checkpoint) parts() int32 {
+	return int32(max(1, (cp.Size+cp.PartSize-1)/cp.PartSize))
+}
+
+// errUploadGone is returned by multipartUpload if the upload of the checkpoint expired or was aborted.
+var errUploadGone = errors.New("s3fs: multipart upload not found")
+
+// multipartUpload uploads a file by parts for putResumable.
+type multipartUpload interface {
+	// create starts the upload and returns its id.
+	create(ctx context.Context) (string, error)
+
+	// uploadPart uploads the part of the body.
+	uploadPart(ctx context.Context, uploadID string, number int32, body io.ReadSeeker) (checkpointPart, error)
+
+	// complete assembles the parts in order.
+	complete(ctx context.Context, uploadID string, parts []checkpointPart) error
+}
+
+// size returns the size of the part.
+func (cp *checkpoint) size(number int32) int64 {
+	offset := int64(number-1) * cp.PartSize
+	return min(cp.PartSize, cp.Size-offset)
+}
+
+// putResumable uploads the parts missing from the checkpoint by the concurrency, persisting it after each part.
+// The checkpoint file is removed once completed, or kept for resuming if failed.
+// The upload starts over if the one of the checkpoint expired or was aborted.
+func putResumable(ctx context.Context, up multipartUpload, cp *checkpoint, path string, r io.ReaderAt, concurrency int, t *tracker, bandwidth *limiter) error {
+	resumed := cp.UploadID != ""
+	err := uploadParts(ctx, up, cp, path, r, concurrency, t, bandwidth)
+	if resumed && errors.Is(err, errUploadGone) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		cp.UploadID, cp.Parts = "", nil
+		err = uploadParts(ctx, up, cp, path, r, concurrency, t, bandwidth)
+	}
+	return err
+}
+
+// uploadParts uploads the parts of putResumable, which starts a new upload if the checkpoint has none.
+func uploadParts(ctx context.Context, up multipartUpload, cp *checkpoint, path string, r io.ReaderAt, concurrency int, t *tracker, bandwidth *limiter) error {
+	if cp.UploadID == "" {
+		id, err := up.create(ctx)
+		if err != nil {
+			return err
+		}
+		cp.UploadID = id
+	}
+	// compacts the parts appended, also a torn line if any
+	if err := cp.save(path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var missing []int32
+	for number := int32(1); number <= cp.parts(); number++ {
+		if !slices.ContainsFunc(cp.Parts, func(p checkpointPart) bool { return p.Number == number }) {
+			missing = append(missing, number)
+		}
+	}
+	if t != nil {
+		t.bytes.Store(cp.Size) // the progress resumes from the parts uploaded before
+		for _, number := range missing {
+			t.bytes.Add(-cp.size(number))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+		sem  = make(chan struct{}, max(1, concurrency))
+	)
+	for _, number := range missing {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			body := io.NewSectionReader(r, int64(number-1)*cp.PartSize, cp.size(number))
+			err := bandwidth.wait(ctx, body.Size()) // paid before, since the sdk may read the part more than once
+			var part checkpointPart
+			if err == nil {
+				ctx, done := observePart(ctx, number, body.Size())
+				part, err = up.uploadPart(ctx, cp.UploadID, number, body)
+				done(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				cp.Parts = append(cp.Parts, part)
+				err = appendPart(f, part)
+				t.add(body.Size(), number)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("upload part %d: %w", number, err))
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	slices.SortFunc(cp.Parts, func(a, b checkpointPart) int { return int(a.Number - b.Number) })
+	if err := up.complete(ctx, cp.UploadID, cp.Parts); err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,135 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/longkai/s3fs"
+)
+
+func TestPutResumable(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		parts = make(map[string]int)
+		fail  = "3"
+	)
+	const partSize = 5 << 20
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if number := r.URL.Query().Get("partNumber"); number != "" {
+			mu.Lock()
+			parts[number]++
+			failed := number == fail
+			mu.Unlock()
+			if failed {
+				http.Error(w, "crashed", http.StatusBadRequest)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}), withOptions(
+		s3fs.WithBufferSize(0),
+		s3fs.WithUploadPartSize(partSize),
+		s3fs.WithUploadConcurrency(1),
+	), withOptFns(func(o *s3.Options) { o.RetryMaxAttempts = 1 }))
+	defer done()
+	content := bytes.Repeat([]byte("0123456789abcdef"), (4*partSize+100)/16)
+	checkpoint := filepath.Join(t.TempDir(), "big.checkpoint")
+	ctx := context.TODO()
+	r := fs.(s3fs.ResumableFS)
+	if err := r.PutResumable(ctx, "big", bytes.NewReader(content), int64(len(content)), checkpoint); err == nil {
+		t.Fatal("PutResumable should fail at part 3")
+	}
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Fatalf("checkpoint should be kept: %v", err)
+	}
+
+	mu.Lock()
+	fail = ""
+	mu.Unlock()
+	if err := r.PutResumable(ctx, "big", bytes.NewReader(content), int64(len(content)), checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	for _, number := range []string{"1", "2"} {
+		if parts[number] != 1 {
+			t.Fatalf("part %s uploaded %d times, want once", number, parts[number])
+		}
+	}
+	if parts["3"] != 2 || parts["5"] != 1 {
+		t.Fatalf("parts uploaded %v, want part 3 retried and 5 parts", parts)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint should be removed: %v", err)
+	}
+	b, err := fs.ReadFileWithContext(ctx, "big")
+	if err != nil || !bytes.Equal(b, content) {
+		t.Fatalf("read %d bytes, %v, want %d bytes", len(b), err, len(content))
+	}
+}
+
+func TestPutResumableExpired(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		parts   = make(map[string]int)
+		expired string
+		fail    = "2"
+	)
+	const partSize = 5 << 20
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		if number := r.URL.Query().Get("partNumber"); number != "" {
+			mu.Lock()
+			parts[number]++
+			failed := number == fail
+			if failed {
+				expired = r.URL.Query().Get("uploadId")
+			}
+			gone := fail == "" && r.URL.Query().Get("uploadId") == expired
+			mu.Unlock()
+			if failed {
+				http.Error(w, "crashed", http.StatusBadRequest)
+				return
+			}
+			if gone {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchUpload</Code><Message>aborted</Message></Error>`)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}), withOptions(
+		s3fs.WithBufferSize(0),
+		s3fs.WithUploadPartSize(partSize),
+		s3fs.WithUploadConcurrency(1),
+	), withOptFns(func(o *s3.Options) { o.RetryMaxAttempts = 1 }))
+	defer done()
+	content := bytes.Repeat([]byte("0123456789abcdef"), (3*partSize+100)/16)
+	checkpoint := filepath.Join(t.TempDir(), "big.checkpoint")
+	ctx := context.TODO()
+	r := fs.(s3fs.ResumableFS)
+	if err := r.PutResumable(ctx, "big", bytes.NewReader(content), int64(len(content)), checkpoint); err == nil {
+		t.Fatal("PutResumable should fail at part 2")
+	}
+
+	mu.Lock()
+	fail = ""
+	mu.Unlock()
+	if err := r.PutResumable(ctx, "big", bytes.NewReader(content), int64(len(content)), checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if parts["1"] != 2 || parts["2"] != 3 || parts["4"] != 1 {
+		t.Fatalf("parts uploaded %v, want the upload started over", parts)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint should be removed: %v", err)
+	}
+	b, err := fs.ReadFileWithContext(ctx, "big")
+	if err != nil || !bytes.Equal(b, content) {
+		t.Fatalf("read %d bytes, %v, want %d bytes", len(b), err, len(content))
+	}
+}
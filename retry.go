@@ -0,0 +1,126 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// RetryPolicy describes how failed requests are retried.
+//
+// The same policy applies to the aws s3 sdk, the azure blob sdk, and resuming broken downloads.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of tries including the first one, 1 disables retrying.
+	// Zero keeps the sdk's default.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, it doubles after each retry up to MaxDelay.
+	// Each delay is randomized into [delay/2, delay] to avoid retrying in lockstep.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Retryable reports whether a failed request should be retried, status is the HTTP status code,
+	// or zero if there is no response, e.g., a connection error or a download broken halfway.
+	// Nil keeps each sdk's own classification, and always resumes broken downloads.
+	Retryable func(status int, err error) bool
+
+	// Timeout is the deadline of each operation, e.g., a Put, a Delete or a single chunk download,
+	// retries included. Zero means no deadline other than the ctx's.
+	Timeout time.Duration
+}
+
+// delay returns the backoff before the given retry, which starts from 0.
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for range retry {
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retries returns how many retries are allowed after the first try.
+func (p *RetryPolicy) retries() int {
+	return max(p.MaxAttempts-1, 0)
+}
+
+func (p *RetryPolicy) awsRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		if p.MaxAttempts > 0 {
+			o.MaxAttempts = p.MaxAttempts
+		}
+		if p.MaxDelay > 0 {
+			o.MaxBackoff = p.MaxDelay
+		}
+		if p.BaseDelay > 0 {
+			o.Backoff = retry.BackoffDelayerFunc(func(attempt int, _ error) (time.Duration, error) {
+				return p.delay(attempt - 1), nil // attempt starts from 1
+			})
+		}
+		if p.Retryable != nil {
+			o.Retryables = []retry.IsErrorRetryable{
+				retry.IsErrorRetryableFunc(func(err error) aws.Ternary {
+					return aws.BoolTernary(p.Retryable(httpStatusCode(err), err))
+				}),
+			}
+		}
+	})
+}
+
+func (p *RetryPolicy) azureRetryOptions() policy.RetryOptions {
+	var opts policy.RetryOptions
+	switch {
+	case p.MaxAttempts == 1:
+		opts.MaxRetries = -1 // zero means the default
+	case p.MaxAttempts > 1:
+		opts.MaxRetries = int32(p.MaxAttempts - 1)
+	}
+	opts.RetryDelay = p.BaseDelay
+	opts.MaxRetryDelay = p.MaxDelay
+	if p.Retryable != nil {
+		opts.ShouldRetry = func(rsp *http.Response, err error) bool {
+			status := 0
+			if rsp != nil {
+				status = rsp.StatusCode
+			}
+			return p.Retryable(status, err)
+		}
+	}
+	return opts
+}
+
+// httpStatusCode extracts the HTTP status code from an aws or azure error, zero if none.
+func httpStatusCode(err error) int {
+	var awsErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &awsErr) {
+		return awsErr.HTTPStatusCode()
+	}
+	var azErr *azcore.ResponseError
+	if errors.As(err, &azErr) {
+		return azErr.StatusCode
+	}
+	return 0
+}
+
+// withTimeout returns ctx bounded by d, if any.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
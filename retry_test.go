@@ -0,0 +1,50 @@
+package s3fs_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestWithRetry(t *testing.T) {
+	var failures atomic.Int32
+	newFs := func(policy s3fs.RetryPolicy) s3fs.FS {
+		fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+			if failures.Add(-1) >= 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}), withOptions(s3fs.WithBufferSize(0), s3fs.WithRetry(policy)))
+		t.Cleanup(done)
+		return fs
+	}
+
+	fs := newFs(s3fs.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	failures.Store(2)
+	if err := fs.Put(context.TODO(), "key", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Put should succeed after 2 retries: %+v", err)
+	}
+
+	var statuses []int
+	fs = newFs(s3fs.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		Retryable: func(status int, err error) bool {
+			statuses = append(statuses, status)
+			return false
+		},
+	})
+	failures.Store(1)
+	if _, err := fs.ReadFile("key"); err == nil {
+		t.Fatal("ReadFile should fail without retrying")
+	}
+	if len(statuses) != 1 || statuses[0] != http.StatusServiceUnavailable {
+		t.Fatalf("Retryable called with %v, want [503]", statuses)
+	}
+}
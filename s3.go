@@ -1,28 +1,44 @@
 package s3fs
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/url"
 	"strings"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 var (
-	_ FS = (*awsS3)(nil)
+	_ FS               = (*awsS3)(nil)
+	_ ContextualStatFS = (*awsS3)(nil)
+	_ ContextualGlobFS = (*awsS3)(nil)
+	_ ListFS           = (*awsS3)(nil)
+	_ ListAfterFS      = (*awsS3)(nil)
+	_ ListDirFS        = (*awsS3)(nil)
+	_ RangeReadFS      = (*awsS3)(nil)
+	_ MetadataFS       = (*awsS3)(nil)
+	_ ResumableFS      = (*awsS3)(nil)
+	_ StatsFS          = (*awsS3)(nil)
+	_ CopyFS           = (*awsS3)(nil)
 )
 
 // New creates a new s3 fs implement, one bucket per fs.
 func New(options ...Option) (NamespacedFS, error) {
 	fs := &awsS3{}
+	fs.counters = new(counters)
 	// Set options.
 	for _, op := range options {
 		op(fs)
@@ -32,70 +48,85 @@ func New(options ...Option) (NamespacedFS, error) {
 	if fs.region == "" {
 		fs.region = "us-east-1" // see General endpoints in https://docs.aws.amazon.com/general/latest/gr/rande.html
 	}
+	if fs.resume == nil {
+		fs.resume = fs.retry
+	}
+	if fs.resume == nil {
+		fs.resume = &RetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond}
+	}
+	if err := fs.sse.validate(); err != nil {
+		return nil, err
+	}
+	if fs.checksum != "" && newChecksum(fs.checksum) == nil {
+		return nil, fmt.Errorf("s3fs: unknown checksum algorithm %q", fs.checksum)
+	}
 
-	if strings.Contains(fs.endpoint, "blob.core") {
-		// it's auzre blob
-		if fs.sk != "" {
-			cred, err := azblob.NewSharedKeyCredential(fs.ak, fs.sk)
-			if err != nil {
-				return nil, err
-			}
-			cli, err := azblob.NewClientWithSharedKeyCredential(fs.endpoint, cred, nil)
-			if err != nil {
-				return nil, err
-			}
-			return &azBlobFs{
-				client:    cli,
-				container: *fs.ns,
-				bufLen:    fs.bufLen,
-			}, nil
-		}
-		u, err := url.Parse(fs.endpoint)
-		if err != nil {
-			return nil, err
-		}
-		var cli *azblob.Client
-		if u.Query().Get("sig") != "" {
-			// SAS token
-			cli, err = azblob.NewClientWithNoCredential(fs.endpoint, nil)
-		} else {
-			// Microsoft Entra ID
-			cred, err := azidentity.NewDefaultAzureCredential(nil)
-			if err != nil {
-				return nil, err
-			}
-			cli, err = azblob.NewClient(fs.endpoint, cred, nil)
-		}
-		if err != nil {
-			return nil, err
-		}
-		return &azBlobFs{
-			client:    cli,
-			container: *fs.ns,
-			bufLen:    fs.bufLen,
-		}, nil
+	name := fs.backend
+	if name == "" {
+		name = detectBackend(fs.endpoint)
 	}
+	backendsMu.RLock()
+	newFs, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("s3fs: unknown backend %q", name)
+	}
+	return newFs(fs)
+}
 
+// newAwsS3 creates the aws s3 backend.
+func newAwsS3(fs *awsS3) (NamespacedFS, error) {
 	// init s3 client, optFns lets you customize everything!
-	fs.client = s3.New(s3.Options{
+	creds, err := fs.awsCredentials()
+	if err != nil {
+		return nil, err
+	}
+	opts := s3.Options{
 		Region:       fs.region,
-		BaseEndpoint: aws.String(fs.endpoint), // https://aws.github.io/aws-sdk-go-v2/docs/configuring-sdk/endpoints/
-		Credentials:  credentials.NewStaticCredentialsProvider(fs.ak, fs.sk, ""),
-	}, fs.optFns...)
+		Credentials:  creds,
+		UsePathStyle: fs.usePathStyle,
+	}
+	if fs.endpoint != "" {
+		opts.BaseEndpoint = aws.String(fs.endpoint) // https://aws.github.io/aws-sdk-go-v2/docs/configuring-sdk/endpoints/
+	}
+	if fs.retry != nil {
+		opts.Retryer = fs.retry.awsRetryer()
+	}
+	if fs.requests != nil {
+		opts.APIOptions = append(opts.APIOptions, fs.requests.awsAPIOption)
+	}
+	if fs.checksum == ChecksumMD5 {
+		return nil, errors.New("s3fs: aws s3 checksum must be CRC32, CRC32C, CRC64NVME, SHA1 or SHA256")
+	}
+	fs.client = s3.New(opts, fs.optFns...)
 	fs.presignClient = s3.NewPresignClient(fs.client)
 	return fs, nil
 }
 
 type awsS3 struct {
 	// optional
-	bufLen int64
-	ns     *string
+	objectConfig
+	uploadConfig
+	ns *string
 
 	// facade, most common usage
 	ak, sk   string
 	region   string
 	endpoint string
 
+	token         string
+	credsProvider aws.CredentialsProvider
+
+	azConnStr    string
+	azCredential func() (azcore.TokenCredential, error)
+
+	usePathStyle bool
+	backend      string
+
+	retry *RetryPolicy
+	// requests limits the requests sent by the client, nil means unlimited.
+	requests *limiter
+
 	// custom everything
 	optFns []func(*s3.Options)
 
@@ -103,17 +134,41 @@ type awsS3 struct {
 	presignClient *s3.PresignClient
 }
 
+// awsCredentials resolves the credentials in order: WithCredentialsProvider, WithCredential, then the default chain,
+// i.e., env vars, shared config and credentials files, web identity token file, ECS container and EC2 instance metadata.
+func (a *awsS3) awsCredentials() (aws.CredentialsProvider, error) {
+	switch {
+	case a.credsProvider != nil:
+		return a.credsProvider, nil
+	case a.ak != "" || a.sk != "":
+		return credentials.NewStaticCredentialsProvider(a.ak, a.sk, a.token), nil
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(a.region))
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Credentials, nil
+}
+
 // Client returns the underlying s3 client for advanced usages.
 func (a *awsS3) Client() *s3.Client {
 	return a.client
 }
 
 // PresignGet implements FS.
-func (a *awsS3) PresignGet(ctx context.Context, name string, optFns ...func(*s3.PresignOptions)) (string, error) {
-	rsp, err := a.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+func (a *awsS3) PresignGet(ctx context.Context, name string, optFns ...func(*s3.PresignOptions)) (_ string, err error) {
+	ctx, done := observe(ctx, a.observer, &Operation{Op: OpPresign, Namespace: *a.ns, Key: name})
+	defer func() { done(0, err) }()
+	sse, err := sseFrom(ctx, a.sse)
+	if err != nil {
+		return "", err
+	}
+	input := &s3.GetObjectInput{
 		Bucket: a.ns,
 		Key:    aws.String(name),
-	}, optFns...)
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.customer()
+	rsp, err := a.presignClient.PresignGetObject(ctx, input, optFns...)
 	if err != nil {
 		return "", err
 	}
@@ -121,11 +176,17 @@ func (a *awsS3) PresignGet(ctx context.Context, name string, optFns ...func(*s3.
 }
 
 // PresignPut implements FS.
-func (a *awsS3) PresignPut(ctx context.Context, name string, optFns ...func(*s3.PresignOptions)) (string, error) {
-	rsp, err := a.presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+func (a *awsS3) PresignPut(ctx context.Context, name string, optFns ...func(*s3.PresignOptions)) (_ string, err error) {
+	ctx, done := observe(ctx, a.observer, &Operation{Op: OpPresign, Namespace: *a.ns, Key: name})
+	defer func() { done(0, err) }()
+	input := &s3.PutObjectInput{
 		Bucket: a.ns,
 		Key:    aws.String(name),
-	}, optFns...)
+	}
+	if err := a.putSSE(ctx, input); err != nil {
+		return "", err
+	}
+	rsp, err := a.presignClient.PresignPutObject(ctx, input, optFns...)
 	if err != nil {
 		return "", err
 	}
@@ -140,6 +201,16 @@ func (a *awsS3) String() string {
 }`, *a.ns, a.client)
 }
 
+// location identifies the bucket, i.e., <endpoint>/<bucket>.
+func (a *awsS3) location() string {
+	return newS3Client(a.client, *a.ns, a.sse, a.checksum).location()
+}
+
+// objectClient returns the client of the objects of the bucket.
+func (a *awsS3) objectClient() client {
+	return a.hedged(a.logged(a.observed(newS3Client(a.client, *a.ns, a.sse, a.checksum))))
+}
+
 // Namespace implements BucketableFS.
 func (a *awsS3) Namespace(bucket string) FS {
 	if bucket == "" {
@@ -152,11 +223,15 @@ func (a *awsS3) Namespace(bucket string) FS {
 
 // Delete implements FS.
 func (a *awsS3) Delete(ctx context.Context, name string) error {
+	ctx, done := observe(ctx, a.observer, &Operation{Op: OpDelete, Namespace: *a.ns, Key: name})
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
 	_, err := a.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: a.ns,
 		Key:    aws.String(name),
 	})
-	return err
+	done(0, err)
+	return notFoundError("delete", name, err)
 }
 
 // Open implements FS.
@@ -166,30 +241,215 @@ func (a *awsS3) Open(name string) (fs.File, error) {
 
 // OpenWithContext implements FS.
 func (a *awsS3) OpenWithContext(ctx context.Context, name string) (fs.File, error) {
-	obj := &object{
-		ctx:    ctx,
-		client: newS3Client(a.client, *a.ns),
-		bufLen: a.bufLen,
-		name:   name,
-	}
-	return obj, obj.fillChunk(false) // first chunk contains metadata
+	return a.openObject(ctx, a.objectClient(), name)
 }
 
 // Put implements FS.
 func (a *awsS3) Put(ctx context.Context, name string, reader io.Reader) error {
+	return a.PutWithMetadata(ctx, name, reader, Metadata{})
+}
+
+// PutWithMetadata implements MetadataFS.
+func (a *awsS3) PutWithMetadata(ctx context.Context, name string, reader io.Reader, metadata Metadata) (err error) {
+	t := a.track(OpPut, name, readerSize(reader))
+	op := &Operation{Op: OpPut, Namespace: *a.ns, Key: name}
+	ctx, done := observe(ctx, a.observer, op)
+	defer func() { done(t.transferred(), err) }()
+	ctx = a.observeParts(ctx, op)
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
 	uploader := manager.NewUploader(a.client, func(u *manager.Uploader) {
 		// backward compat ref: https://github.com/aws/aws-sdk-go-v2/pull/3151
 		u.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		if a.checksum != "" {
+			u.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenSupported
+		}
+		if a.partSize > 0 {
+			u.PartSize = a.partSize
+		}
+		if a.concurrency > 0 {
+			u.Concurrency = a.concurrency
+		}
+		u.LeavePartsOnError = a.leavePartsOnError
+		u.ClientOptions = append(u.ClientOptions, t.s3Uploads, a.bandwidth.s3Uploads)
+		if a.observer != nil {
+			u.ClientOptions = append(u.ClientOptions, func(o *s3.Options) {
+				o.APIOptions = append(o.APIOptions, awsPartObserver)
+			})
+		}
 	})
 	input := &s3.PutObjectInput{
-		Bucket: a.ns,
-		Key:    aws.String(name),
-		Body:   reader,
+		Bucket:   a.ns,
+		Key:      aws.String(name),
+		Body:     reader, // as is, see s3Uploads
+		Metadata: metadata.User,
+	}
+	if metadata.ContentType != "" {
+		input.ContentType = aws.String(metadata.ContentType)
+	}
+	if metadata.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(metadata.ContentEncoding)
+	}
+	if err := a.putSSE(ctx, input); err != nil {
+		return err
+	}
+	input.ChecksumAlgorithm = types.ChecksumAlgorithm(a.checksum) // computed by the uploader for each part
+	_, err = uploader.Upload(ctx, input)
+	return err
+}
+
+// putSSE sets the server side encryption of the put, the uploader passes it on to multipart uploads.
+func (a *awsS3) putSSE(ctx context.Context, input *s3.PutObjectInput) error {
+	sse, err := sseFrom(ctx, a.sse)
+	if err != nil {
+		return err
+	}
+	input.ServerSideEncryption = sse.serverSideEncryption()
+	input.SSEKMSKeyId, input.SSEKMSEncryptionContext = sse.kms()
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.customer()
+	return nil
+}
+
+// maxCopySize is the max size of objects copied by a single CopyObject request.
+const maxCopySize = 5 << 30
+
+// CopyFrom implements CopyFS, for the files of src sharing the client, e.g., by Namespace, up to 5GiB.
+// The copy is encrypted like Put, while the source is decrypted by the SSE-C key of src if any.
+func (a *awsS3) CopyFrom(ctx context.Context, src FS, srcName, name string, size int64) error {
+	s, ok := src.(*awsS3)
+	if !ok || s.client != a.client || size > maxCopySize {
+		return errors.ErrUnsupported
+	}
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
+	sse, err := sseFrom(ctx, a.sse)
+	if err != nil {
+		return err
+	}
+	key := strings.ReplaceAll(strings.ReplaceAll(url.QueryEscape(srcName), "+", "%20"), "%2F", "/")
+	input := &s3.CopyObjectInput{
+		Bucket:     a.ns,
+		Key:        aws.String(name),
+		CopySource: aws.String(*s.ns + "/" + key),
 	}
-	_, err := uploader.Upload(ctx, input)
+	input.ServerSideEncryption = sse.serverSideEncryption()
+	input.SSEKMSKeyId, input.SSEKMSEncryptionContext = sse.kms()
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sse.customer()
+	input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = s.sse.customer()
+	input.ChecksumAlgorithm = types.ChecksumAlgorithm(a.checksum)
+	_, err = a.client.CopyObject(ctx, input)
 	return err
 }
 
+// Stat implements ContextualStatFS.
+func (a *awsS3) Stat(name string) (fs.FileInfo, error) {
+	return a.StatWithContext(context.Background(), name)
+}
+
+// StatWithContext implements ContextualStatFS.
+func (a *awsS3) StatWithContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.objectClient().headObject(ctx, name, "")
+}
+
+// statIfNoneMatch implements conditionalStatFS.
+func (a *awsS3) statIfNoneMatch(ctx context.Context, name, etag string) (fs.FileInfo, error) {
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
+	info, err := a.objectClient().headObject(ctx, name, etag)
+	if err != nil {
+		return nil, err // not a typed nil
+	}
+	return info, nil
+}
+
+// ReadRange implements RangeReadFS.
+func (a *awsS3) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	return a.readRange(ctx, a.objectClient(), name, offset, length)
+}
+
+// List implements ListFS.
+func (a *awsS3) List(ctx context.Context, prefix string, fn func(fs.FileInfo) error) error {
+	return a.ListAfter(ctx, prefix, "", fn)
+}
+
+// ListAfter implements ListAfterFS.
+func (a *awsS3) ListAfter(ctx context.Context, prefix, after string, fn func(fs.FileInfo) error) (err error) {
+	ctx, done := observe(ctx, a.observer, &Operation{Op: OpList, Namespace: *a.ns, Key: prefix})
+	defer func() { done(0, err) }()
+	input := &s3.ListObjectsV2Input{
+		Bucket: a.ns,
+		Prefix: aws.String(prefix),
+	}
+	if after != "" {
+		input.StartAfter = aws.String(after)
+	}
+	p := s3.NewListObjectsV2Paginator(a.client, input)
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, obj := range page.Contents {
+			info := &objectInfo{
+				name:    aws.ToString(obj.Key),
+				size:    aws.ToInt64(obj.Size),
+				modTime: aws.ToTime(obj.LastModified),
+				etag:    aws.ToString(obj.ETag),
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListDir implements ListDirFS.
+func (a *awsS3) ListDir(ctx context.Context, prefix string, fn func(fs.FileInfo) error) (err error) {
+	ctx, done := observe(ctx, a.observer, &Operation{Op: OpList, Namespace: *a.ns, Key: prefix})
+	defer func() { done(0, err) }()
+	p := s3.NewListObjectsV2Paginator(a.client, &s3.ListObjectsV2Input{
+		Bucket:    a.ns,
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, obj := range page.Contents {
+			info := &objectInfo{
+				name:    aws.ToString(obj.Key),
+				size:    aws.ToInt64(obj.Size),
+				modTime: aws.ToTime(obj.LastModified),
+				etag:    aws.ToString(obj.ETag),
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		for _, dir := range page.CommonPrefixes {
+			if err := fn(&dirInfo{strings.TrimSuffix(aws.ToString(dir.Prefix), "/")}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Glob implements ContextualGlobFS.
+func (a *awsS3) Glob(pattern string) ([]string, error) {
+	return a.GlobWithContext(context.Background(), pattern)
+}
+
+// GlobWithContext implements ContextualGlobFS.
+func (a *awsS3) GlobWithContext(ctx context.Context, pattern string) ([]string, error) {
+	return glob(ctx, a, pattern)
+}
+
 // ReadFile implements FS.
 func (a *awsS3) ReadFile(name string) ([]byte, error) {
 	return a.ReadFileWithContext(context.Background(), name)
@@ -197,14 +457,120 @@ func (a *awsS3) ReadFile(name string) ([]byte, error) {
 
 // ReadFileWithContext implements FS.
 func (a *awsS3) ReadFileWithContext(ctx context.Context, name string) ([]byte, error) {
-	obj := &object{
-		ctx:    ctx,
-		client: newS3Client(a.client, *a.ns),
-		bufLen: a.bufLen,
-		name:   name,
-	}
+	obj := a.newObject(ctx, a.objectClient(), name)
+	defer obj.cancel()
 	if err := obj.dl(); err != nil {
 		return nil, err
 	}
 	return obj.buf.Bytes(), nil
 }
+
+// PutResumable implements ResumableFS.
+func (a *awsS3) PutResumable(ctx context.Context, name string, r io.ReaderAt, size int64, checkpoint string) (err error) {
+	t := a.track(OpPut, name, size)
+	op := &Operation{Op: OpPut, Namespace: *a.ns, Key: name}
+	ctx, done := observe(ctx, a.observer, op)
+	defer func() { done(t.transferred(), err) }()
+	ctx = a.observeParts(ctx, op)
+	sse, err := sseFrom(ctx, a.sse)
+	if err != nil {
+		return err
+	}
+	partSize := a.partSizeFor(size, manager.DefaultUploadPartSize, int64(manager.MaxUploadParts))
+	cp, err := loadCheckpoint(checkpoint, a.location(), name, size, partSize)
+	if err != nil {
+		return err
+	}
+	concurrency := cmp.Or(a.concurrency, manager.DefaultUploadConcurrency)
+	return putResumable(ctx, &s3Upload{a: a, key: name, sse: sse}, cp, checkpoint, r, concurrency, t, a.bandwidth)
+}
+
+// s3Upload is a multipart upload of aws s3.
+type s3Upload struct {
+	a   *awsS3
+	key string
+	sse *SSE
+}
+
+// optFns disables the checksums unless WithChecksum like Put.
+func (u *s3Upload) optFns(o *s3.Options) {
+	if u.a.checksum == "" {
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+	}
+}
+
+func (u *s3Upload) create(ctx context.Context) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:            u.a.ns,
+		Key:               aws.String(u.key),
+		ChecksumAlgorithm: types.ChecksumAlgorithm(u.a.checksum),
+	}
+	input.ServerSideEncryption = u.sse.serverSideEncryption()
+	input.SSEKMSKeyId, input.SSEKMSEncryptionContext = u.sse.kms()
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = u.sse.customer()
+	rsp, err := u.a.client.CreateMultipartUpload(ctx, input, u.optFns)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(rsp.UploadId), nil
+}
+
+func (u *s3Upload) uploadPart(ctx context.Context, uploadID string, number int32, body io.ReadSeeker) (checkpointPart, error) {
+	input := &s3.UploadPartInput{
+		Bucket:            u.a.ns,
+		Key:               aws.String(u.key),
+		UploadId:          aws.String(uploadID),
+		PartNumber:        aws.Int32(number),
+		Body:              body,
+		ChecksumAlgorithm: types.ChecksumAlgorithm(u.a.checksum),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = u.sse.customer()
+	rsp, err := u.a.client.UploadPart(ctx, input, u.optFns)
+	if err != nil {
+		return checkpointPart{}, uploadGone(err)
+	}
+	part := checkpointPart{Number: number, ETag: aws.ToString(rsp.ETag)}
+	_, part.Checksum = s3Checksum("", rsp.ChecksumCRC32, rsp.ChecksumCRC32C, rsp.ChecksumCRC64NVME, rsp.ChecksumSHA1, rsp.ChecksumSHA256)
+	return part, nil
+}
+
+func (u *s3Upload) complete(ctx context.Context, uploadID string, parts []checkpointPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, p := range parts {
+		completed[i] = types.CompletedPart{PartNumber: aws.Int32(p.Number), ETag: aws.String(p.ETag)}
+		if p.Checksum == "" {
+			continue
+		}
+		switch checksum := aws.String(p.Checksum); u.a.checksum {
+		case ChecksumCRC32:
+			completed[i].ChecksumCRC32 = checksum
+		case ChecksumCRC32C:
+			completed[i].ChecksumCRC32C = checksum
+		case ChecksumCRC64NVME:
+			completed[i].ChecksumCRC64NVME = checksum
+		case ChecksumSHA1:
+			completed[i].ChecksumSHA1 = checksum
+		case ChecksumSHA256:
+			completed[i].ChecksumSHA256 = checksum
+		}
+	}
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:          u.a.ns,
+		Key:             aws.String(u.key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = u.sse.customer()
+	_, err := u.a.client.CompleteMultipartUpload(ctx, input, u.optFns)
+	return uploadGone(err)
+}
+
+// uploadGone converts the NoSuchUpload error of the multipart upload into errUploadGone.
+func uploadGone(err error) error {
+	var noSuchUpload *types.NoSuchUpload
+	var apiErr smithy.APIError
+	if errors.As(err, &noSuchUpload) || errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchUpload" {
+		return fmt.Errorf("%w: %w", errUploadGone, err)
+	}
+	return err
+}
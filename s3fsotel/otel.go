@@ -0,0 +1,135 @@
+// Package s3fsotel reports the operations of s3fs as OpenTelemetry traces and metrics.
+package s3fsotel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/longkai/s3fs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scope = "github.com/longkai/s3fs/s3fsotel"
+
+// Option configures the observer returned by New.
+type Option func(o *observer)
+
+// WithTracerProvider sets the tracer provider, defaults to the global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *observer) {
+		o.tp = tp
+	}
+}
+
+// WithMeterProvider sets the meter provider, defaults to the global one.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(o *observer) {
+		o.mp = mp
+	}
+}
+
+// New returns the observer for s3fs.WithObserver, which records a span for each operation, and the metrics:
+//   - s3fs.operation.duration, the histogram of the durations of operations in seconds.
+//   - s3fs.operation.bytes, the counter of the bytes transferred by operations.
+//
+// Both are attributed by the operation, the namespace, and the error type and the HTTP status code of failures.
+func New(options ...Option) (s3fs.Observer, error) {
+	o := &observer{}
+	for _, op := range options {
+		op(o)
+	}
+	if o.tp == nil {
+		o.tp = otel.GetTracerProvider()
+	}
+	if o.mp == nil {
+		o.mp = otel.GetMeterProvider()
+	}
+	o.tracer = o.tp.Tracer(scope)
+	meter := o.mp.Meter(scope)
+	var err error
+	if o.duration, err = meter.Float64Histogram("s3fs.operation.duration",
+		metric.WithDescription("Duration of s3fs operations."), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if o.bytes, err = meter.Int64Counter("s3fs.operation.bytes",
+		metric.WithDescription("Bytes transferred by s3fs operations."), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+type observer struct {
+	tp trace.TracerProvider
+	mp metric.MeterProvider
+
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	bytes    metric.Int64Counter
+}
+
+// Start implements s3fs.Observer.
+func (o *observer) Start(ctx context.Context, op *s3fs.Operation) context.Context {
+	attrs := []attribute.KeyValue{
+		attribute.String("s3fs.operation", op.Op),
+		attribute.String("s3fs.namespace", op.Namespace),
+		attribute.String("s3fs.key", op.Key),
+	}
+	switch op.Op {
+	case s3fs.OpGet:
+		attrs = append(attrs, attribute.Int64("s3fs.range.offset", op.Offset), attribute.Int64("s3fs.range.end", op.End))
+	case s3fs.OpPutPart:
+		attrs = append(attrs, attribute.Int("s3fs.part", int(op.Part)))
+	}
+	ctx, _ = o.tracer.Start(ctx, "s3fs."+op.Op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx
+}
+
+// End implements s3fs.Observer.
+func (o *observer) End(ctx context.Context, op *s3fs.Operation) {
+	attrs := []attribute.KeyValue{
+		attribute.String("s3fs.operation", op.Op),
+		attribute.String("s3fs.namespace", op.Namespace),
+	}
+	if op.Status != 0 {
+		attrs = append(attrs, attribute.Int("http.response.status_code", op.Status))
+	}
+	if op.Err != nil {
+		attrs = append(attrs, attribute.String("error.type", errorType(op.Err)))
+	}
+	set := metric.WithAttributes(attrs...)
+	o.duration.Record(ctx, op.Duration.Seconds(), set)
+	if op.Bytes > 0 {
+		o.bytes.Add(ctx, op.Bytes, set)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("s3fs.bytes", op.Bytes))
+	if op.Status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", op.Status))
+	}
+	if op.Err != nil {
+		span.RecordError(op.Err)
+		span.SetStatus(codes.Error, op.Err.Error())
+	}
+	span.End()
+}
+
+// errorType returns the low cardinality type of the error.
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	var code interface{ ErrorCode() string } // aws api errors
+	if errors.As(err, &code) && code.ErrorCode() != "" {
+		return code.ErrorCode()
+	}
+	return fmt.Sprintf("%T", err)
+}
@@ -0,0 +1,85 @@
+package s3fsotel_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/longkai/s3fs"
+	"github.com/longkai/s3fs/s3fsotel"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestObserver(t *testing.T) {
+	ts := httptest.NewServer(gofakes3.New(s3mem.New(), gofakes3.WithAutoBucket(true)).Server())
+	defer ts.Close()
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	observer, err := s3fsotel.New(
+		s3fsotel.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))),
+		s3fsotel.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := s3fs.New(
+		s3fs.WithCredential("AK******", "SK******"),
+		s3fs.WithNamespace("test-bucket"),
+		s3fs.WithObserver(observer),
+		s3fs.WithOptFns(func(o *s3.Options) { o.BaseEndpoint = &ts.URL }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.TODO()
+	if err := fsys.Put(ctx, "file", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadFileWithContext(ctx, "file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadFileWithContext(ctx, "missing"); err == nil {
+		t.Fatal("read missing file should fail")
+	}
+
+	var names []string
+	for _, s := range spans.Ended() {
+		names = append(names, s.Name())
+	}
+	if got := strings.Join(names, ","); got != "s3fs.put,s3fs.get,s3fs.get" {
+		t.Fatalf("spans %s, want put and gets", got)
+	}
+	if failed := spans.Ended()[2]; failed.Status().Code != codes.Error {
+		t.Fatalf("span of the missing file got status %v, want error", failed.Status())
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	var bytes int64
+	var durations uint64
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			for _, p := range data.DataPoints {
+				bytes += p.Value
+			}
+		case metricdata.Histogram[float64]:
+			for _, p := range data.DataPoints {
+				durations += p.Count
+			}
+		}
+	}
+	if bytes != 10 || durations != 3 {
+		t.Fatalf("metrics of %d bytes and %d durations, want 10 bytes and 3 durations", bytes, durations)
+	}
+}
@@ -0,0 +1,133 @@
+package s3fs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// SSE is the server side encryption of objects, see SSES3, SSEKMS, SSEC and AzureEncryptionScope.
+type SSE struct {
+	algorithm   types.ServerSideEncryption
+	kmsKeyID    string
+	kmsContext  map[string]string
+	customerKey []byte
+	scope       string
+}
+
+// SSES3 encrypts objects by the keys managed by s3, i.e., SSE-S3. Azure blobs are always encrypted so.
+func SSES3() *SSE {
+	return &SSE{algorithm: types.ServerSideEncryptionAes256}
+}
+
+// SSEKMS encrypts objects by the aws kms key, i.e., SSE-KMS. The key id defaults to the aws managed key if empty,
+// the encryption context is optional.
+func SSEKMS(keyID string, encryptionContext map[string]string) *SSE {
+	return &SSE{algorithm: types.ServerSideEncryptionAwsKms, kmsKeyID: keyID, kmsContext: encryptionContext}
+}
+
+// SSEC encrypts objects by the 256-bit key of the caller, i.e., SSE-C of s3 or customer-provided keys of azure blob.
+// The key is sent with every request of the objects, including ranged gets, heads, copies and presigned urls.
+func SSEC(key []byte) *SSE {
+	return &SSE{customerKey: key}
+}
+
+// AzureEncryptionScope encrypts blobs by the encryption scope of the storage account, e.g., with customer-managed keys.
+func AzureEncryptionScope(scope string) *SSE {
+	return &SSE{scope: scope}
+}
+
+// WithServerSideEncryption sets the server side encryption of all the objects, which can be overridden per call by
+// ContextWithSSE. Options of the other service are ignored, e.g., SSE-KMS for azure blob.
+func WithServerSideEncryption(sse *SSE) Option {
+	return func(fs *awsS3) {
+		fs.sse = sse
+	}
+}
+
+type sseKey struct{}
+
+// ContextWithSSE overrides the server side encryption set by WithServerSideEncryption for calls with the context.
+func ContextWithSSE(ctx context.Context, sse *SSE) context.Context {
+	return context.WithValue(ctx, sseKey{}, sse)
+}
+
+// sseFrom returns the server side encryption of the context if any, or the default one.
+func sseFrom(ctx context.Context, sse *SSE) (*SSE, error) {
+	if s, ok := ctx.Value(sseKey{}).(*SSE); ok {
+		sse = s
+	}
+	if err := sse.validate(); err != nil {
+		return nil, err
+	}
+	return sse, nil
+}
+
+func (s *SSE) validate() error {
+	if s != nil && s.customerKey != nil && len(s.customerKey) != 32 {
+		return fmt.Errorf("s3fs: SSE-C key must be 256 bits, got %d", len(s.customerKey)*8)
+	}
+	return nil
+}
+
+// customer returns the headers of SSE-C, i.e., the algorithm, the base64 key and its base64 md5, or nils.
+func (s *SSE) customer() (algorithm, key, keyMD5 *string) {
+	if s == nil || s.customerKey == nil {
+		return nil, nil, nil
+	}
+	sum := md5.Sum(s.customerKey)
+	return aws.String("AES256"),
+		aws.String(base64.StdEncoding.EncodeToString(s.customerKey)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// kms returns the headers of SSE-KMS, i.e., the key id and the base64 json of the encryption context, or nils.
+func (s *SSE) kms() (keyID, encryptionContext *string) {
+	if s == nil || s.algorithm != types.ServerSideEncryptionAwsKms {
+		return nil, nil
+	}
+	if s.kmsKeyID != "" {
+		keyID = aws.String(s.kmsKeyID)
+	}
+	if len(s.kmsContext) > 0 {
+		b, _ := json.Marshal(s.kmsContext)
+		encryptionContext = aws.String(base64.StdEncoding.EncodeToString(b))
+	}
+	return keyID, encryptionContext
+}
+
+func (s *SSE) serverSideEncryption() types.ServerSideEncryption {
+	if s == nil {
+		return ""
+	}
+	return s.algorithm
+}
+
+// cpkInfo returns the customer-provided key of azure blob, or nil.
+func (s *SSE) cpkInfo() *blob.CPKInfo {
+	if s == nil || s.customerKey == nil {
+		return nil
+	}
+	sum := sha256.Sum256(s.customerKey)
+	return &blob.CPKInfo{
+		EncryptionAlgorithm: to.Ptr(blob.EncryptionAlgorithmTypeAES256),
+		EncryptionKey:       aws.String(base64.StdEncoding.EncodeToString(s.customerKey)),
+		EncryptionKeySHA256: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+	}
+}
+
+// cpkScopeInfo returns the encryption scope of azure blob, or nil.
+func (s *SSE) cpkScopeInfo() *blob.CPKScopeInfo {
+	if s == nil || s.scope == "" {
+		return nil
+	}
+	return &blob.CPKScopeInfo{EncryptionScope: aws.String(s.scope)}
+}
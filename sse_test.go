@@ -0,0 +1,173 @@
+package s3fs_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+// headerRecorder serves a fake s3 and records the request headers by method.
+type headerRecorder struct {
+	mu      sync.Mutex
+	headers map[string][]http.Header
+}
+
+func (rec *headerRecorder) take(method string) []http.Header {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	h := rec.headers[method]
+	delete(rec.headers, method)
+	return h
+}
+
+func newHeaderRecorder(t *testing.T, options ...s3fs.Option) (*headerRecorder, s3fs.NamespacedFS) {
+	rec := &headerRecorder{headers: make(map[string][]http.Header)}
+	fs, done := newTestFs(withHandler(func(w http.ResponseWriter, r *http.Request, next http.Handler) {
+		rec.mu.Lock()
+		rec.headers[r.Method] = append(rec.headers[r.Method], r.Header.Clone())
+		rec.mu.Unlock()
+		next.ServeHTTP(w, r)
+	}), withOptions(append([]s3fs.Option{s3fs.WithBufferSize(0)}, options...)...))
+	t.Cleanup(done)
+	return rec, fs
+}
+
+func TestSSEC(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	sum := md5.Sum(key)
+	wantKey, wantMD5 := base64.StdEncoding.EncodeToString(key), base64.StdEncoding.EncodeToString(sum[:])
+	check := func(op string, headers []http.Header) {
+		t.Helper()
+		if len(headers) == 0 {
+			t.Fatalf("%s: no requests", op)
+		}
+		for _, h := range headers {
+			if h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "AES256" ||
+				h.Get("X-Amz-Server-Side-Encryption-Customer-Key") != wantKey ||
+				h.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5") != wantMD5 {
+				t.Fatalf("%s: got headers %v, want SSE-C headers", op, h)
+			}
+		}
+	}
+
+	rec, fs := newHeaderRecorder(t, s3fs.WithServerSideEncryption(s3fs.SSEC(key)), s3fs.WithBufferSize(4))
+	ctx := context.TODO()
+	content := "hello, encrypted world"
+	if err := fs.Put(ctx, "secret.txt", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	check("put", rec.take(http.MethodPut))
+
+	if _, err := fs.(s3fs.ContextualStatFS).StatWithContext(ctx, "secret.txt"); err != nil {
+		t.Fatal(err)
+	}
+	check("head", rec.take(http.MethodHead))
+
+	f, err := fs.OpenWithContext(ctx, "secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(b) != content {
+		t.Fatalf("read %q, %v, want %q", b, err, content)
+	}
+	check("ranged get", rec.take(http.MethodGet))
+
+	dst := fs.Namespace("copy-bucket").(s3fs.FS)
+	if _, err := s3fs.Sync(ctx, fs, dst, ""); err != nil {
+		t.Fatal(err)
+	}
+	puts := rec.take(http.MethodPut)
+	check("copy", puts)
+	if h := puts[len(puts)-1]; h.Get("X-Amz-Copy-Source") == "" ||
+		h.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key") != wantKey {
+		t.Fatalf("copy: got headers %v, want the copy source SSE-C key", h)
+	}
+
+	u, err := fs.(s3fs.PresignFS).PresignGet(ctx, "secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(u)
+	if signed := parsed.Query().Get("X-Amz-SignedHeaders"); !strings.Contains(signed, "x-amz-server-side-encryption-customer-key") {
+		t.Fatalf("presigned headers %q, want the SSE-C headers signed", signed)
+	}
+
+	if _, err := s3fs.New(s3fs.WithServerSideEncryption(s3fs.SSEC(key[:16])), s3fs.WithNamespace("test-bucket")); err == nil {
+		t.Fatal("New with a 128-bit SSE-C key should fail")
+	}
+}
+
+func TestSSEKMS(t *testing.T) {
+	rec, fs := newHeaderRecorder(t, s3fs.WithServerSideEncryption(s3fs.SSES3()))
+	ctx := context.TODO()
+	if err := fs.Put(ctx, "s3.txt", strings.NewReader("sse-s3")); err != nil {
+		t.Fatal(err)
+	}
+	if h := rec.take(http.MethodPut)[0]; h.Get("X-Amz-Server-Side-Encryption") != "AES256" {
+		t.Fatalf("put: got headers %v, want SSE-S3", h)
+	}
+
+	ctx = s3fs.ContextWithSSE(ctx, s3fs.SSEKMS("alias/test", map[string]string{"app": "s3fs"}))
+	if err := fs.Put(ctx, "kms.txt", strings.NewReader("sse-kms")); err != nil {
+		t.Fatal(err)
+	}
+	h := rec.take(http.MethodPut)[0]
+	if h.Get("X-Amz-Server-Side-Encryption") != "aws:kms" || h.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") != "alias/test" {
+		t.Fatalf("put: got headers %v, want SSE-KMS", h)
+	}
+	b, _ := base64.StdEncoding.DecodeString(h.Get("X-Amz-Server-Side-Encryption-Context"))
+	var encryptionContext map[string]string
+	if err := json.Unmarshal(b, &encryptionContext); err != nil || encryptionContext["app"] != "s3fs" {
+		t.Fatalf("put: got encryption context %q, want app=s3fs", b)
+	}
+}
+
+func TestAzureSSE(t *testing.T) {
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.Header().Set("Content-Length", "0")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer ts.Close()
+
+	const key = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	fs, err := s3fs.New(
+		s3fs.WithAzureConnectionString("DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey="+key+";BlobEndpoint="+ts.URL+"/devstoreaccount1;"),
+		s3fs.WithNamespace("container"),
+		s3fs.WithServerSideEncryption(s3fs.SSEC(bytes.Repeat([]byte{7}, 32))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.(s3fs.ContextualStatFS).StatWithContext(context.TODO(), "blob"); err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("X-Ms-Encryption-Key") == "" || header.Get("X-Ms-Encryption-Key-Sha256") == "" {
+		t.Fatalf("stat: got headers %v, want the customer-provided key", header)
+	}
+
+	ctx := s3fs.ContextWithSSE(context.TODO(), s3fs.AzureEncryptionScope("scope"))
+	if err := fs.Put(ctx, "blob", strings.NewReader("scoped")); err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("X-Ms-Encryption-Scope") != "scope" || header.Get("X-Ms-Encryption-Key") != "" {
+		t.Fatalf("put: got headers %v, want the encryption scope only", header)
+	}
+}
@@ -0,0 +1,260 @@
+package s3fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SyncCompare decides whether a file differs between the source and the destination of Sync.
+type SyncCompare int
+
+const (
+	// SyncBySizeAndModTime copies files whose sizes differ, or which are modified later in the source.
+	// Modification times within a second are considered the same, since storages keep them in different precisions.
+	SyncBySizeAndModTime SyncCompare = iota
+	// SyncByETag copies files whose sizes or ETags differ. ETags are comparable within the same kind of storages
+	// only, it falls back to SyncBySizeAndModTime if either side has no ETag.
+	SyncByETag
+	// SyncByHash copies files whose sizes or sha256 hashes differ, which downloads the files of both sides.
+	SyncByHash
+)
+
+// SyncOption configures Sync.
+type SyncOption func(s *syncer)
+
+// WithSyncCompare sets how files are compared, defaults to SyncBySizeAndModTime.
+func WithSyncCompare(compare SyncCompare) SyncOption {
+	return func(s *syncer) {
+		s.compare = compare
+	}
+}
+
+// WithSyncDelete deletes the files in the destination which don't exist in the source.
+func WithSyncDelete() SyncOption {
+	return func(s *syncer) {
+		s.delete = true
+	}
+}
+
+// WithSyncDryRun reports what would be copied and deleted without changing the destination.
+func WithSyncDryRun() SyncOption {
+	return func(s *syncer) {
+		s.dryRun = true
+	}
+}
+
+// WithSyncConcurrency sets the max number of files copied or deleted at the same time, defaults to 8.
+func WithSyncConcurrency(n int) SyncOption {
+	return func(s *syncer) {
+		s.concurrency = n
+	}
+}
+
+// SyncResult summarizes a Sync, names are sorted.
+type SyncResult struct {
+	// Copied are the files copied, or to be copied in dry-run.
+	Copied []string
+	// Deleted are the files deleted, or to be deleted in dry-run.
+	Deleted []string
+	// Unchanged is the number of files already up to date.
+	Unchanged int
+	// Bytes is the total size of the copied files.
+	Bytes int64
+	// Failed are the files failed to compare, copy or delete.
+	Failed map[string]error
+}
+
+type syncer struct {
+	src, dst    FS
+	compare     SyncCompare
+	delete      bool
+	dryRun      bool
+	concurrency int
+
+	mu     sync.Mutex
+	result SyncResult
+}
+
+// Sync mirrors the files with the prefix from src to dst, both of which must implement ListFS.
+// Missing and changed files are copied concurrently, within the service if possible, e.g., between buckets
+// of the same s3 client. The error joins the errors of all failed files, which are reported by the result as well.
+func Sync(ctx context.Context, src, dst FS, prefix string, options ...SyncOption) (*SyncResult, error) {
+	s := &syncer{
+		src:         src,
+		dst:         dst,
+		concurrency: 8,
+		result:      SyncResult{Failed: make(map[string]error)},
+	}
+	for _, op := range options {
+		op(s)
+	}
+	s.concurrency = max(s.concurrency, 1)
+
+	srcFiles, err := listAll(ctx, src, prefix)
+	if err != nil {
+		return nil, err
+	}
+	dstFiles, err := listAll(ctx, dst, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			f()
+		}()
+	}
+	for name, info := range srcFiles {
+		run(func() { s.syncFile(ctx, name, info, dstFiles[name]) })
+	}
+	if s.delete {
+		for name := range dstFiles {
+			if _, ok := srcFiles[name]; !ok {
+				run(func() { s.deleteFile(ctx, name) })
+			}
+		}
+	}
+	wg.Wait()
+
+	slices.Sort(s.result.Copied)
+	slices.Sort(s.result.Deleted)
+	var errs []error
+	for name, err := range s.result.Failed {
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	return &s.result, errors.Join(errs...)
+}
+
+// listAll lists the files with the prefix by their names.
+func listAll(ctx context.Context, fsys FS, prefix string) (map[string]fs.FileInfo, error) {
+	l, ok := fsys.(ListFS)
+	if !ok {
+		return nil, fmt.Errorf("s3fs: %T can't list files", fsys)
+	}
+	files := make(map[string]fs.FileInfo)
+	err := l.List(ctx, prefix, func(info fs.FileInfo) error {
+		files[info.Name()] = info
+		return nil
+	})
+	return files, err
+}
+
+func (s *syncer) syncFile(ctx context.Context, name string, src, dst fs.FileInfo) {
+	if dst != nil {
+		changed, err := s.changed(ctx, name, src, dst)
+		if err != nil {
+			s.fail(name, err)
+			return
+		}
+		if !changed {
+			s.mu.Lock()
+			s.result.Unchanged++
+			s.mu.Unlock()
+			return
+		}
+	}
+	if !s.dryRun {
+		if err := s.copy(ctx, name, src.Size()); err != nil {
+			s.fail(name, err)
+			return
+		}
+	}
+	s.mu.Lock()
+	s.result.Copied = append(s.result.Copied, name)
+	s.result.Bytes += src.Size()
+	s.mu.Unlock()
+}
+
+func (s *syncer) changed(ctx context.Context, name string, src, dst fs.FileInfo) (bool, error) {
+	if src.Size() != dst.Size() {
+		return true, nil
+	}
+	switch s.compare {
+	case SyncByETag:
+		se, sok := src.(ETagger)
+		de, dok := dst.(ETagger)
+		if sok && dok && se.ETag() != "" && de.ETag() != "" {
+			return se.ETag() != de.ETag(), nil
+		}
+	case SyncByHash:
+		srcSum, err := hashFile(ctx, s.src, name)
+		if err != nil {
+			return false, err
+		}
+		dstSum, err := hashFile(ctx, s.dst, name)
+		if err != nil {
+			return false, err
+		}
+		return srcSum != dstSum, nil
+	}
+	return src.ModTime().Sub(dst.ModTime()) > time.Second, nil
+}
+
+func (s *syncer) copy(ctx context.Context, name string, size int64) error {
+	if d, ok := s.dst.(CopyFS); ok {
+		if err := d.CopyFrom(ctx, s.src, name, name, size); !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+	r, err := openStream(ctx, s.src, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return s.dst.Put(ctx, name, r)
+}
+
+func (s *syncer) deleteFile(ctx context.Context, name string) {
+	if !s.dryRun {
+		if err := s.dst.Delete(ctx, name); err != nil {
+			s.fail(name, err)
+			return
+		}
+	}
+	s.mu.Lock()
+	s.result.Deleted = append(s.result.Deleted, name)
+	s.mu.Unlock()
+}
+
+func (s *syncer) fail(name string, err error) {
+	s.mu.Lock()
+	s.result.Failed[name] = err
+	s.mu.Unlock()
+}
+
+// hashFile returns the sha256 hash of the file content.
+func hashFile(ctx context.Context, fsys FS, name string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	r, err := openStream(ctx, fsys, name)
+	if err != nil {
+		return sum, err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return sum, err
+	}
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+// openStream opens the file for sequential reading, which streams the content if the fs can read ranges,
+// rather than buffering the whole file.
+func openStream(ctx context.Context, fsys FS, name string) (io.ReadCloser, error) {
+	if r, ok := fsys.(RangeReadFS); ok {
+		return r.ReadRange(ctx, name, 0, -1)
+	}
+	return fsys.OpenWithContext(ctx, name)
+}
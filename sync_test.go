@@ -0,0 +1,94 @@
+package s3fs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestSync(t *testing.T) {
+	remote, fn := newTestFs()
+	defer fn()
+	ctx := context.TODO()
+	for name, content := range map[string]string{
+		"data/a":     "hello",
+		"data/sub/b": "world",
+		"other/c":    "out of prefix",
+	} {
+		if err := remote.Put(ctx, name, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync := func(src, dst s3fs.FS, wantCopied, wantDeleted []string, wantUnchanged int, options ...s3fs.SyncOption) {
+		t.Helper()
+		res, err := s3fs.Sync(ctx, src, dst, "data/", options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(res.Copied, wantCopied) || !slices.Equal(res.Deleted, wantDeleted) || res.Unchanged != wantUnchanged {
+			t.Fatalf("Sync() = copied %v, deleted %v, unchanged %d, want %v, %v, %d",
+				res.Copied, res.Deleted, res.Unchanged, wantCopied, wantDeleted, wantUnchanged)
+		}
+	}
+
+	dir := t.TempDir()
+	local := s3fs.DirFS(dir)
+	sync(remote, local, []string{"data/a", "data/sub/b"}, nil, 0, s3fs.WithSyncDryRun())
+	if _, err := os.Stat(filepath.Join(dir, "data")); !os.IsNotExist(err) {
+		t.Fatalf("dry-run sync wrote files: %v", err)
+	}
+	sync(remote, local, []string{"data/a", "data/sub/b"}, nil, 0)
+	sync(remote, local, nil, nil, 2)
+	if b, err := os.ReadFile(filepath.Join(dir, "data", "sub", "b")); err != nil || string(b) != "world" {
+		t.Fatalf("synced file = %q, %v, want %q", b, err, "world")
+	}
+
+	if err := remote.Put(ctx, "data/a", strings.NewReader("hello again")); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Put(ctx, "data/z", strings.NewReader("extraneous")); err != nil {
+		t.Fatal(err)
+	}
+	sync(remote, local, []string{"data/a"}, nil, 1)
+	sync(remote, local, nil, []string{"data/z"}, 2, s3fs.WithSyncDelete(), s3fs.WithSyncDryRun())
+	sync(remote, local, nil, []string{"data/z"}, 2, s3fs.WithSyncDelete())
+	if _, err := os.Stat(filepath.Join(dir, "data", "z")); !os.IsNotExist(err) {
+		t.Fatalf("extraneous file not deleted: %v", err)
+	}
+
+	// within the service
+	backup := remote.(s3fs.NamespacedFS).Namespace("backup-bucket")
+	sync(remote, backup, []string{"data/a", "data/sub/b"}, nil, 0, s3fs.WithSyncCompare(s3fs.SyncByETag))
+	sync(remote, backup, nil, nil, 2, s3fs.WithSyncCompare(s3fs.SyncByETag))
+	if b, err := backup.ReadFile("data/a"); err != nil || string(b) != "hello again" {
+		t.Fatalf("copied file = %q, %v, want %q", b, err, "hello again")
+	}
+
+	// same size but different content, and newer than the source
+	fname := filepath.Join(dir, "data", "a")
+	if err := os.WriteFile(fname, []byte("HELLO AGAIN"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	for _, name := range []string{fname, filepath.Join(dir, "data", "sub", "b")} {
+		if err := os.Chtimes(name, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync(backup, local, nil, nil, 2)
+	sync(backup, local, []string{"data/a"}, nil, 1, s3fs.WithSyncCompare(s3fs.SyncByHash))
+	if b, err := os.ReadFile(fname); err != nil || string(b) != "hello again" {
+		t.Fatalf("synced file = %q, %v, want %q", b, err, "hello again")
+	}
+
+	if _, err := s3fs.Sync(ctx, remote, s3fs.Cached(local, t.TempDir()), "data/"); err == nil {
+		t.Fatal("Sync to the fs which can't list should fail")
+	}
+}
@@ -0,0 +1,181 @@
+package s3fs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// URLOpener creates the fs for the url, and returns the key of the file the url refers to.
+//
+// The options are the ones passed to FromURL, they should be applied after the ones derived from the url.
+type URLOpener func(u *url.URL, options ...Option) (FS, string, error)
+
+var (
+	urlOpenersMu sync.RWMutex
+	urlOpeners   = map[string]URLOpener{
+		"s3":    openS3URL,
+		"az":    openAzURL,
+		"file":  openFileURL,
+		"http":  openHTTPURL,
+		"https": openHTTPURL,
+	}
+)
+
+// RegisterScheme registers the opener for urls of the given scheme, replacing the existing one if any.
+func RegisterScheme(scheme string, opener URLOpener) {
+	urlOpenersMu.Lock()
+	defer urlOpenersMu.Unlock()
+	urlOpeners[strings.ToLower(scheme)] = opener
+}
+
+// FromURL creates the fs for the url, and returns the key of the file the url refers to.
+//
+// Supported urls are:
+//   - s3://<bucket>/<key>?region=<region>&endpoint=<endpoint>
+//   - az://<container>/<blob>?account=<storage-account>&domain=<blob.core.windows.net>&<sas-token>,
+//     account defaults to the AZURE_STORAGE_ACCOUNT env
+//   - https://<storage-account>.blob.core.windows.net/<container>/<blob>?<sas-token>
+//   - https://<bucket>.s3.<region>.amazonaws.com/<key>
+//   - http(s)://<host>/<bucket>/<key>, i.e., path-style s3 compatible services
+//   - file:///<path>, or file:///<volume>/<path> on windows, e.g., file:///C:/x
+//
+// Other schemes can be plugged in by RegisterScheme.
+// The options are applied after the ones derived from the url, e.g., to set the credential.
+func FromURL(rawURL string, options ...Option) (FS, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	urlOpenersMu.RLock()
+	opener, ok := urlOpeners[strings.ToLower(u.Scheme)]
+	urlOpenersMu.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("s3fs: unsupported url scheme %q", u.Scheme)
+	}
+	return opener(u, options...)
+}
+
+// OpenURL opens the file the url refers to, see FromURL for the supported urls.
+func OpenURL(ctx context.Context, rawURL string, options ...Option) (fs.File, error) {
+	fsys, key, err := FromURL(rawURL, options...)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.OpenWithContext(ctx, key)
+}
+
+func openS3URL(u *url.URL, options ...Option) (FS, string, error) {
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("s3fs: missing bucket in %q", u.Redacted())
+	}
+	q := u.Query()
+	opts := []Option{WithBackend(BackendS3), WithNamespace(u.Host), WithRegion(q.Get("region"))}
+	if endpoint := q.Get("endpoint"); endpoint != "" {
+		opts = append(opts, WithEndpoint(endpoint), withPathStyle())
+	}
+	fsys, err := New(append(opts, options...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	return fsys, urlKey(u), nil
+}
+
+func openAzURL(u *url.URL, options ...Option) (FS, string, error) {
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("s3fs: missing container in %q", u.Redacted())
+	}
+	q := u.Query()
+	account := q.Get("account")
+	if account == "" {
+		account = os.Getenv("AZURE_STORAGE_ACCOUNT")
+	}
+	if account == "" {
+		return nil, "", fmt.Errorf("s3fs: missing storage account in %q", u.Redacted())
+	}
+	domain := q.Get("domain")
+	if domain == "" {
+		domain = "blob.core.windows.net"
+	}
+	q.Del("account")
+	q.Del("domain")
+
+	endpoint := url.URL{Scheme: "https", Host: account + "." + domain, RawQuery: q.Encode()} // the rest is the sas token
+	opts := []Option{WithBackend(BackendAzBlob), WithEndpoint(endpoint.String()), WithNamespace(u.Host)}
+	fsys, err := New(append(opts, options...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	return fsys, urlKey(u), nil
+}
+
+func openFileURL(u *url.URL, options ...Option) (FS, string, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, "", fmt.Errorf("s3fs: unsupported file host in %q", u.Redacted())
+	}
+	// the volume of windows paths is the root, e.g., file:///C:/x is the file x of C:\
+	root, key := "/", urlKey(u)
+	if vol := filepath.VolumeName(filepath.FromSlash(key)); vol != "" {
+		root, key = vol+string(filepath.Separator), strings.TrimPrefix(key[len(vol):], "/")
+	}
+	return DirFS(root, options...), key, nil
+}
+
+func openHTTPURL(u *url.URL, options ...Option) (FS, string, error) {
+	endpoint := url.URL{Scheme: u.Scheme, Host: u.Host, RawQuery: u.RawQuery}
+	host := u.Hostname()
+	ns, key, _ := strings.Cut(urlKey(u), "/")
+	var opts []Option
+	switch {
+	case strings.Contains(host, ".blob.core."):
+		// https://<storage-account>.blob.core.windows.net/<container>/<blob>?<sas-token>
+		opts = append(opts, WithBackend(BackendAzBlob))
+	case strings.HasSuffix(host, ".amazonaws.com") && strings.Contains(host, ".s3."):
+		// virtual-hosted style: https://<bucket>.s3.<region>.amazonaws.com/<key>
+		bucket, rest, _ := strings.Cut(host, ".s3.")
+		endpoint.Host = "s3." + rest
+		ns, key = bucket, urlKey(u)
+		opts = append(opts, WithBackend(BackendS3), WithRegion(awsRegion(endpoint.Host)))
+	default:
+		// path style: https://s3.<region>.amazonaws.com/<bucket>/<key> or any s3 compatible services.
+		endpoint.RawQuery = ""
+		opts = append(opts, WithBackend(BackendS3), WithRegion(awsRegion(host)), withPathStyle())
+	}
+	if ns == "" {
+		return nil, "", fmt.Errorf("s3fs: missing bucket or container in %q", u.Redacted())
+	}
+	opts = append(opts, WithEndpoint(endpoint.String()), WithNamespace(ns))
+	fsys, err := New(append(opts, options...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	return fsys, key, nil
+}
+
+// awsRegion extracts the region from aws s3 hosts like s3.<region>.amazonaws.com, or returns "".
+func awsRegion(host string) string {
+	rest, ok := strings.CutSuffix(host, ".amazonaws.com")
+	if !ok {
+		return ""
+	}
+	rest = strings.TrimPrefix(rest, "s3.")
+	if rest == "s3" || strings.Contains(rest, ".") {
+		return ""
+	}
+	return rest
+}
+
+func urlKey(u *url.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+func withPathStyle() Option {
+	return func(fs *awsS3) {
+		fs.usePathStyle = true
+	}
+}
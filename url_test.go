@@ -0,0 +1,89 @@
+package s3fs_test
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/longkai/s3fs"
+)
+
+func TestOpenURL(t *testing.T) {
+	ts := newTestServer(nil)
+	defer ts.Close()
+
+	rawURL := ts.URL + "/test-bucket/path/to/file"
+	fs, key, err := s3fs.FromURL(rawURL, s3fs.WithCredential("AK******", "SK******"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "path/to/file" {
+		t.Fatalf("FromURL(%q) key = %q, want %q", rawURL, key, "path/to/file")
+	}
+	if err := fs.Put(context.TODO(), key, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s3fs.OpenURL(context.TODO(), rawURL, s3fs.WithCredential("AK******", "SK******"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("OpenURL(%q) read %q, want %q", rawURL, b, "hello")
+	}
+}
+
+func TestOpenFileURL(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "hello.txt")
+	if err := os.WriteFile(name, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// i.e., file:///C:/... on windows
+	u := url.URL{Scheme: "file", Path: "/" + strings.TrimPrefix(filepath.ToSlash(name), "/")}
+	f, err := s3fs.OpenURL(context.TODO(), u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("OpenURL(%q) read %q, want %q", u.String(), b, "hello")
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	if _, _, err := s3fs.FromURL("mem://dir/key"); err == nil {
+		t.Fatal("FromURL with unknown scheme should fail")
+	}
+
+	dir := t.TempDir()
+	s3fs.RegisterScheme("mem", func(u *url.URL, options ...s3fs.Option) (s3fs.FS, string, error) {
+		return s3fs.DirFS(filepath.Join(dir, u.Host)), strings.TrimPrefix(u.Path, "/"), nil
+	})
+	fs, key, err := s3fs.FromURL("mem://dir/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "key" {
+		t.Fatalf("FromURL key = %q, want %q", key, "key")
+	}
+	if err := fs.Put(context.TODO(), key, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dir", "key")); err != nil {
+		t.Fatal(err)
+	}
+}